@@ -15,6 +15,9 @@ type Context struct {
 
 	// reference to the parent http.Request
 	req *http.Request
+
+	// hooks executed once the request has been handled
+	hooks []func(w http.ResponseWriter, r *http.Request, status int)
 }
 
 // Retruns the Context associated with the http.Request.
@@ -42,6 +45,22 @@ func (c *Context) Request() *http.Request {
 	return c.req
 }
 
+// OnComplete registers a hook that is executed once the request has been
+// handled, even if the handler panics. Hooks are executed in LIFO order,
+// similar to deferred function calls.
+func (c *Context) OnComplete(hook func(w http.ResponseWriter, r *http.Request, status int)) {
+	c.hooks = append(c.hooks, hook)
+}
+
+// Complete executes the hooks registered with OnComplete in LIFO order. It is
+// invoked by the router once the request has been handled.
+func (c *Context) Complete(w http.ResponseWriter, r *http.Request, status int) {
+	for i := len(c.hooks) - 1; i >= 0; i-- {
+		c.hooks[i](w, r, status)
+	}
+	c.hooks = nil
+}
+
 // wrapper decorates an http.Request's Body (io.ReadCloser) so that we can
 // bind a Context to the Request. This is obviously a hack that i'd rather
 // avoid, however, it is for the greater good ...
@@ -2,14 +2,20 @@ package router
 
 import (
 	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
 	"net"
 	"net/http"
-	"path/filepath"
 	"regexp"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/drone/routes/exp/context"
+	"github.com/drone/routes/internal/static"
 )
 
 const (
@@ -22,18 +28,73 @@ const (
 	PUT     = "PUT"
 )
 
-type route struct {
+// Route is a handle to a route registered with the Router. It is used to
+// attach middleware filters that only apply to this route.
+type Route struct {
+	router  *Router
 	method  string
+	pattern string
 	regex   *regexp.Regexp
 	params  map[int]string
 	handler http.HandlerFunc
+	filters []http.HandlerFunc
+}
+
+// With adds middleware filters that are only executed for this Route. Route
+// filters run after the Router filters, and before the request handler.
+func (r *Route) With(filters ...http.HandlerFunc) *Route {
+	r.router.Lock()
+	r.filters = append(r.filters, filters...)
+	r.router.Unlock()
+	return r
+}
+
+// AfterFunc is a middleware filter that is executed after the request has
+// been handled, with the status code written to the response.
+type AfterFunc func(w http.ResponseWriter, r *http.Request, status int)
+
+// ErrorFunc renders an error response with the given status code. It is
+// used by the Router for the responses it generates, such as 404 Not Found
+// or 500 Internal Server Error.
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, code int)
+
+// Panic describes a panic recovered while serving a request.
+type Panic struct {
+	Value   interface{} // the value passed to panic
+	Stack   []byte      // the stack trace of the goroutine
+	Pattern string      // the route pattern matched by the request
+}
+
+// PanicFunc is a hook that is invoked when a panic is recovered, for
+// example to report the panic to an error tracker.
+type PanicFunc func(r *http.Request, p *Panic)
+
+// HandlerErrorFunc is a hook that is invoked with the errors returned by the
+// handlers adapted with Handle, for example to report the errors.
+type HandlerErrorFunc func(r *http.Request, err error)
+
+// StatusCoder is implemented by errors that map to an HTTP status code, for
+// example a not found error that maps to 404 Not Found.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// errorMapping maps the errors matching target to a status code.
+type errorMapping struct {
+	target error
+	code   int
 }
 
 type Router struct {
 	sync.RWMutex
-	routes  []*route
-	filters []http.HandlerFunc
-	params  map[string]interface{}
+	routes   []*Route
+	filters  []http.HandlerFunc
+	after    []AfterFunc
+	errors   ErrorFunc
+	panics   []PanicFunc
+	mappings []errorMapping
+	hooks    []HandlerErrorFunc
+	params   map[string]interface{}
 }
 
 func New() *Router {
@@ -43,45 +104,146 @@ func New() *Router {
 }
 
 // Get adds a new Route for GET requests.
-func (r *Router) Get(pattern string, handler http.HandlerFunc) {
-	r.AddRoute(GET, pattern, handler)
+func (r *Router) Get(pattern string, handler http.HandlerFunc) *Route {
+	return r.AddRoute(GET, pattern, handler)
 }
 
 // Put adds a new Route for PUT requests.
-func (r *Router) Put(pattern string, handler http.HandlerFunc) {
-	r.AddRoute(PUT, pattern, handler)
+func (r *Router) Put(pattern string, handler http.HandlerFunc) *Route {
+	return r.AddRoute(PUT, pattern, handler)
 }
 
 // Del adds a new Route for DELETE requests.
-func (r *Router) Del(pattern string, handler http.HandlerFunc) {
-	r.AddRoute(DELETE, pattern, handler)
+func (r *Router) Del(pattern string, handler http.HandlerFunc) *Route {
+	return r.AddRoute(DELETE, pattern, handler)
 }
 
 // Patch adds a new Route for PATCH requests.
-func (r *Router) Patch(pattern string, handler http.HandlerFunc) {
-	r.AddRoute(PATCH, pattern, handler)
+func (r *Router) Patch(pattern string, handler http.HandlerFunc) *Route {
+	return r.AddRoute(PATCH, pattern, handler)
 }
 
 // Post adds a new Route for POST requests.
-func (r *Router) Post(pattern string, handler http.HandlerFunc) {
-	r.AddRoute(POST, pattern, handler)
-}
-
-// Adds a new Route for Static http requests. Serves
-// static files from the specified directory
-func (r *Router) Static(pattern string, dir string) {
-	//append a regex to the param to match everything
-	// that comes after the prefix
-	pattern = pattern + "(.+)"
-	r.Get(pattern, func(w http.ResponseWriter, req *http.Request) {
-		path := filepath.Clean(req.URL.Path)
-		path = filepath.Join(dir, path)
-		http.ServeFile(w, req, path)
-	})
+func (r *Router) Post(pattern string, handler http.HandlerFunc) *Route {
+	return r.AddRoute(POST, pattern, handler)
+}
+
+// StaticOptions configure how StaticFS serves files.
+type StaticOptions struct {
+	// Index are the names of the files served for a directory, in order of
+	// preference. If empty, index.html is served.
+	Index []string
+
+	// Browse enables the listing of directories without an index file.
+	// Otherwise they are not found.
+	Browse bool
+
+	// Hidden enables serving the files and directories whose name starts
+	// with a dot, such as .well-known. Otherwise they are not found, so that
+	// files such as .env or .git/config are never served.
+	Hidden bool
+
+	// SPA enables the fallback of single-page applications: requests for
+	// files that do not exist, and whose name has no extension, are served
+	// the index file of the root directory, so that the application can
+	// handle its own routes. Requests for missing assets, such as /app.js,
+	// are still not found.
+	SPA bool
+
+	// Precompressed enables serving the precompressed siblings of files,
+	// such as app.js.br or app.js.gz, to the clients that accept their
+	// encoding.
+	Precompressed bool
+
+	// CacheControl are the Cache-Control policies of the files. The first
+	// policy that matches the path of a file is applied.
+	CacheControl []CachePolicy
+}
+
+// Cache-Control values for common policies.
+const (
+	CacheImmutable = static.CacheImmutable // fingerprinted files that never change
+	CacheNoCache   = static.CacheNoCache   // files that must be revalidated
+)
+
+// CachePolicy sets the Cache-Control header of the static files that match
+// a pattern, for example:
+//
+//	[]router.CachePolicy{
+//		{Pattern: "index.html", Value: router.CacheNoCache},
+//		{Pattern: "assets/*", Value: router.CacheImmutable},
+//	}
+type CachePolicy struct {
+	// Pattern matches the path of the file, relative to the root, with the
+	// syntax of path.Match. A pattern without a slash matches the name of
+	// the file in any directory, such as *.html.
+	Pattern string
+
+	// Value is the Cache-Control header value.
+	Value string
+}
+
+// options returns the options of the static file server.
+func (opts *StaticOptions) options() static.Options {
+	o := static.Options{
+		Index:         opts.Index,
+		Browse:        opts.Browse,
+		Hidden:        opts.Hidden,
+		SPA:           opts.SPA,
+		Precompressed: opts.Precompressed,
+	}
+	for _, policy := range opts.CacheControl {
+		o.CacheControl = append(o.CacheControl, static.CachePolicy(policy))
+	}
+	return o
+}
+
+// Static adds a new Route for GET requests that serves the files of the
+// directory under the path prefix, as StaticDir does with the default
+// options.
+func (r *Router) Static(pattern string, dir string) *Route {
+	return r.StaticDir(pattern, dir, nil)
+}
+
+// StaticDir adds a new Route for GET requests that serves the files of the
+// directory under the path prefix, as StaticFS does. Files outside of the
+// directory are never served, even through symbolic links, and links with
+// an absolute target are refused, unlike the files of os.DirFS. It panics
+// if the directory cannot be opened.
+func (r *Router) StaticDir(pattern string, dir string, opts *StaticOptions) *Route {
+	fsys, err := static.DirFS(dir)
+	if err != nil {
+		panic(err)
+	}
+	return r.StaticFS(pattern, fsys, opts)
+}
+
+// StaticFS adds a new Route for GET requests that serves the files of the
+// file system under the path prefix, for example the files embedded in the
+// binary:
+//
+//	//go:embed dist
+//	var dist embed.FS
+//
+//	assets, _ := fs.Sub(dist, "dist")
+//	r.StaticFS("/app", assets, &router.StaticOptions{SPA: true})
+//
+// A request for /app/css/site.css is served the file css/site.css. If opts
+// is nil, the default options are used. The prefix is matched literally,
+// and it panics if the prefix contains a parameter.
+func (r *Router) StaticFS(pattern string, fsys fs.FS, opts *StaticOptions) *Route {
+	if opts == nil {
+		opts = &StaticOptions{}
+	}
+	s, err := static.New(pattern, fsys, opts.options(), r.error)
+	if err != nil {
+		panic(err)
+	}
+	return r.Get(s.Pattern(), s.ServeHTTP)
 }
 
 // Adds a new Route to the Handler
-func (r *Router) AddRoute(method string, pattern string, handler http.HandlerFunc) {
+func (r *Router) AddRoute(method string, pattern string, handler http.HandlerFunc) *Route {
 	r.Lock()
 	defer r.Unlock()
 
@@ -109,11 +271,13 @@ func (r *Router) AddRoute(method string, pattern string, handler http.HandlerFun
 
 	//recreate the url pattern, with parameters replaced
 	//by regular expressions. then compile the regex
-	pattern = strings.Join(parts, "/")
-	regex := regexp.MustCompile(pattern)
+	expr := strings.Join(parts, "/")
+	regex := regexp.MustCompile(expr)
 
-	route := &route{
+	route := &Route{
+		router  : r,
 		method  : method,
+		pattern : pattern,
 		regex   : regex,
 		handler : handler,
 		params  : params,
@@ -121,6 +285,7 @@ func (r *Router) AddRoute(method string, pattern string, handler http.HandlerFun
 
 	//append to the list of Routes
 	r.routes = append(r.routes, route)
+	return route
 }
 
 // Filter adds the middleware filter.
@@ -130,6 +295,50 @@ func (r *Router) Filter(filter http.HandlerFunc) {
 	r.Unlock()
 }
 
+// After adds the middleware filter that is executed after the request has
+// been handled, even if the handler panics. Filters are executed in the
+// order they were added, after any hooks registered on the Context.
+func (r *Router) After(filter AfterFunc) {
+	r.Lock()
+	r.after = append(r.after, filter)
+	r.Unlock()
+}
+
+// ErrorHandler sets the function used to render the error responses
+// generated by the Router. By default a plain text response is written with
+// the status text of the code.
+func (r *Router) ErrorHandler(handler ErrorFunc) {
+	r.Lock()
+	r.errors = handler
+	r.Unlock()
+}
+
+// OnPanic adds a hook that is invoked when a panic is recovered while
+// serving a request.
+func (r *Router) OnPanic(hook PanicFunc) {
+	r.Lock()
+	r.panics = append(r.panics, hook)
+	r.Unlock()
+}
+
+// MapError maps the errors returned by handlers that match the target, as
+// reported by errors.Is, to the status code. For example:
+//
+//	r.MapError(sql.ErrNoRows, http.StatusNotFound)
+func (r *Router) MapError(target error, code int) {
+	r.Lock()
+	r.mappings = append(r.mappings, errorMapping{target, code})
+	r.Unlock()
+}
+
+// OnError adds a hook that is invoked with the errors returned by the
+// handlers adapted with Handle.
+func (r *Router) OnError(hook HandlerErrorFunc) {
+	r.Lock()
+	r.hooks = append(r.hooks, hook)
+	r.Unlock()
+}
+
 // FilterParam adds the middleware filter iff the URL parameter exists.
 func (r *Router) FilterParam(param string, filter http.HandlerFunc) {
 	r.Filter(func(w http.ResponseWriter, req *http.Request) {
@@ -156,14 +365,34 @@ func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	defer r.RUnlock()
 
 	//wrap the response writer in our custom interface
-	w := &responseWriter{writer: rw, Router: r}
+	w := &responseWriter{writer: rw, Router: r, start: time.Now()}
+
+	//the request context, once a matching route is found
+	var c *context.Context
+
+	//recover from panics, and execute the after filters once
+	//the request is handled
+	defer func() {
+		if err := recover(); err != nil {
+			if err == http.ErrAbortHandler {
+				r.complete(w, req, c, http.StatusInternalServerError)
+				panic(err)
+			}
+			r.recover(w, req, err)
+		}
+		r.complete(w, req, c, http.StatusOK)
+	}()
+
+	//serve HEAD requests with the GET routes, unless a HEAD route
+	//matches the url
+	method := r.method(req)
 
 	//find a matching Route
 	for _, route := range r.routes {
 
 		//if the methods don't match, skip this handler
 		//i.e if request.Method is 'PUT' Route.Method must be 'PUT'
-		if req.Method != route.method {
+		if method != route.method {
 			continue
 		}
 
@@ -181,27 +410,235 @@ func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		}
 
 		//create the http.Requests context
-		c := context.Get(req)
+		c = context.Get(req)
 
 		//add url parameters to the context
 		for i, match := range matches[1:] {
 			c.Params.Set(route.params[i], match)
 		}
 
+		//record the route pattern matched by the request
+		w.pattern = route.pattern
+
 		//execute middleware filters
 		for _, filter := range r.filters {
 			filter(w, req)
 			if w.started { return }
 		}
 
+		//execute the route specific middleware filters
+		for _, filter := range route.filters {
+			filter(w, req)
+			if w.started { return }
+		}
+
 		//invoke the request handler
 		route.handler(w, req)
 		return
 	}
 
+	//if the url matches routes for other methods, throw a
+	//method not allowed exception
+	if allow := r.allowed(req.URL.Path); len(allow) != 0 {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		r.error(w, req, http.StatusMethodNotAllowed)
+		return
+	}
+
 	//if no matches to url, throw a not found exception
 	if w.started == false {
-		http.NotFound(w, req)
+		r.error(w, req, http.StatusNotFound)
+	}
+}
+
+// match reports whether the route pattern matches the whole url path.
+func (r *Route) match(path string) bool {
+	matches := r.regex.FindStringSubmatch(path)
+	return len(matches) != 0 && len(matches[0]) == len(path)
+}
+
+// method returns the method of the routes that serve the request. HEAD
+// requests are served by the GET routes, unless a HEAD route matches the url
+// path.
+func (r *Router) method(req *http.Request) string {
+	if req.Method != HEAD {
+		return req.Method
+	}
+	for _, route := range r.routes {
+		if route.method == HEAD && route.match(req.URL.Path) {
+			return HEAD
+		}
+	}
+	return GET
+}
+
+// allowed returns the methods of the routes that match the url path,
+// including HEAD if GET is allowed.
+func (r *Router) allowed(path string) []string {
+	var methods []string
+	seen := make(map[string]bool)
+	for _, route := range r.routes {
+		if seen[route.method] || !route.match(path) {
+			continue
+		}
+		seen[route.method] = true
+		methods = append(methods, route.method)
+	}
+	if seen[GET] && !seen[HEAD] {
+		methods = append(methods, HEAD)
+	}
+	return methods
+}
+
+// complete executes the hooks registered on the Context, followed by the
+// after filters. If the response has not been written to, they receive the
+// provided default status code.
+func (r *Router) complete(w *responseWriter, req *http.Request, c *context.Context, status int) {
+	if w.status != 0 {
+		status = w.status
+	} else if w.started {
+		status = http.StatusOK
+	}
+
+	if c != nil {
+		c.Complete(w, req, status)
+	}
+
+	for _, filter := range r.after {
+		filter(w, req, status)
+	}
+}
+
+// error renders an error response with the given status code, using the
+// ErrorFunc configured for the Router.
+func (r *Router) error(w http.ResponseWriter, req *http.Request, code int) {
+	if r.errors != nil {
+		r.errors(w, req, code)
+		return
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// Handle adapts a handler that returns an error to an http.HandlerFunc. If
+// the handler returns an error, and the response has not been written to,
+// the error is mapped to a status code and rendered with the ErrorFunc of
+// the Router. The status code is given by the first error registered with
+// MapError that matches the error, or by the StatusCode method of the first
+// error in its chain that implements StatusCoder. Other errors are rendered
+// as 500 Internal Server Error.
+func Handle(handler func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		err := handler(w, req)
+		if err == nil {
+			return
+		}
+		if info, ok := Response(w); ok {
+			rw := info.(*responseWriter)
+			rw.Router.handleError(rw, req, err)
+			return
+		}
+		code := statusOf(nil, err)
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+// handleError reports the error returned by a handler to the hooks, and
+// renders it if the response has not been written to. Server errors are
+// logged.
+func (r *Router) handleError(w *responseWriter, req *http.Request, err error) {
+	for _, hook := range r.hooks {
+		hook(req, err)
+	}
+
+	code := statusOf(r.mappings, err)
+	if code >= 500 {
+		log.Printf("routes: error serving %s %s (route %q): %v", req.Method, req.URL.Path, w.pattern, err)
+	}
+	if !w.started {
+		r.error(w, req, code)
+	}
+}
+
+// statusOf returns the status code of the error, using the mappings, or the
+// StatusCoder interface. It returns 500 if the error is not mapped, or is
+// mapped to an invalid status code.
+func statusOf(mappings []errorMapping, err error) int {
+	for _, mapping := range mappings {
+		if errors.Is(err, mapping.target) {
+			return validStatus(mapping.code)
+		}
+	}
+	var coder StatusCoder
+	if errors.As(err, &coder) {
+		return validStatus(coder.StatusCode())
+	}
+	return http.StatusInternalServerError
+}
+
+// validStatus returns the status code if it is a valid final status, which
+// can be written without net/http panicking, or 500 otherwise.
+func validStatus(code int) int {
+	if code < 200 || code > 999 {
+		return http.StatusInternalServerError
+	}
+	return code
+}
+
+// recover handles a panic recovered while serving the request. The panic is
+// logged with the stack trace and matched route pattern, and reported to
+// the panic hooks. If the response has not been written to, a 500 error is
+// rendered.
+func (r *Router) recover(w *responseWriter, req *http.Request, err interface{}) {
+	p := &Panic{Value: err, Stack: debug.Stack(), Pattern: w.pattern}
+	log.Printf("routes: panic serving %s %s (route %q): %v\n%s", req.Method, req.URL.Path, p.Pattern, p.Value, p.Stack)
+
+	for _, hook := range r.panics {
+		hook(req, p)
+	}
+
+	if !w.started {
+		r.error(w, req, http.StatusInternalServerError)
+	}
+}
+
+// ResponseInfo is a read-only view of the response recorded by the Router.
+// It allows middleware, such as logging, metrics or tracing, to inspect the
+// response without wrapping the http.ResponseWriter again.
+type ResponseInfo interface {
+	// Status returns the status code written to the response, or 0 if
+	// nothing has been written yet. A response written without calling
+	// WriteHeader reports 200 OK.
+	Status() int
+
+	// BytesWritten returns the number of bytes written to the response body.
+	BytesWritten() int64
+
+	// Start returns the time the Router started handling the request.
+	Start() time.Time
+
+	// TimeToFirstByte returns the time elapsed between the start of the
+	// request and the first write to the response, or 0 if nothing has
+	// been written yet.
+	TimeToFirstByte() time.Duration
+
+	// Pattern returns the route pattern matched by the request, or an empty
+	// string if no route was matched.
+	Pattern() string
+}
+
+// Response returns the ResponseInfo recorded by the Router for the given
+// http.ResponseWriter. Writers that wrap the Router's writer are unwrapped
+// using their Unwrap method.
+func Response(w http.ResponseWriter) (ResponseInfo, bool) {
+	for {
+		switch v := w.(type) {
+		case *responseWriter:
+			return v, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil, false
+		}
 	}
 }
 
@@ -212,6 +649,10 @@ type responseWriter struct {
 	writer  http.ResponseWriter
 	started bool
 	status  int
+	pattern string
+	written int64     // number of bytes written to the body
+	start   time.Time // time the request was started
+	first   time.Time // time of the first write to the response
 }
 
 // Header returns the header map that will be sent by WriteHeader.
@@ -222,20 +663,121 @@ func (w *responseWriter) Header() http.Header {
 // Write writes the data to the connection as part of an HTTP reply,
 // and sets `started` to true
 func (w *responseWriter) Write(p []byte) (int, error) {
-	w.started = true
-	return w.writer.Write(p)
+	w.begin(http.StatusOK)
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
 }
 
 // WriteHeader sends an HTTP response header with status code,
 // and sets `started` to true
 func (w *responseWriter) WriteHeader(code int) {
-	w.status = code
-	w.started = true
+	w.begin(code)
 	w.writer.WriteHeader(code)
 }
 
+// begin records the status code and time of the first write to the
+// response, and sets `started` to true
+func (w *responseWriter) begin(code int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.status = code
+	w.first = time.Now()
+}
+
+// Status returns the status code written to the response.
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the number of bytes written to the response body.
+func (w *responseWriter) BytesWritten() int64 {
+	return w.written
+}
+
+// Start returns the time the request was started.
+func (w *responseWriter) Start() time.Time {
+	return w.start
+}
+
+// TimeToFirstByte returns the time elapsed between the start of the request
+// and the first write to the response.
+func (w *responseWriter) TimeToFirstByte() time.Duration {
+	if w.first.IsZero() {
+		return 0
+	}
+	return w.first.Sub(w.start)
+}
+
+// Pattern returns the route pattern matched by the request.
+func (w *responseWriter) Pattern() string {
+	return w.pattern
+}
+
+// Flush sends any buffered data to the client, if supported by the
+// underlying http.ResponseWriter.
+func (w *responseWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError sends any buffered data to the client, and returns an error
+// if the underlying http.ResponseWriter does not support flushing.
+func (w *responseWriter) FlushError() error {
+	switch f := w.writer.(type) {
+	case interface{ FlushError() error }:
+		w.begin(http.StatusOK)
+		return f.FlushError()
+	case http.Flusher:
+		w.begin(http.StatusOK)
+		f.Flush()
+		return nil
+	}
+	return http.ErrNotSupported
+}
+
+// Push initiates an HTTP/2 server push, if supported by the underlying
+// http.ResponseWriter.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.writer.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// ReadFrom reads data from src until EOF and writes it to the connection,
+// using the underlying io.ReaderFrom if available to enable zero-copy sends.
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.begin(http.StatusOK)
+	var n int64
+	var err error
+	if rf, ok := w.writer.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(w.writer, src)
+	}
+	w.written += n
+	return n, err
+}
+
 // The Hijacker interface is implemented by ResponseWriters that allow an
-// HTTP handler to take over the connection.
+// HTTP handler to take over the connection. An error is returned if the
+// underlying http.ResponseWriter does not support hijacking.
 func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	return w.writer.(http.Hijacker).Hijack()
+	h, ok := w.writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.started = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter, which allows the
+// http.ResponseController to access its optional interfaces.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.writer
 }
@@ -1,10 +1,17 @@
 package router
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"strconv"
 	"testing"
+	"testing/fstest"
 	"github.com/drone/routes/exp/context"
 )
 
@@ -82,7 +89,7 @@ func TestRouteFilterHalt(t *testing.T) {
 	mux.ServeHTTP(w, r)
 
 	if w.Code != 400 {
-		t.Errorf("Code set to [%s]; want [%s]", w.Code, http.StatusBadRequest)
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusBadRequest)
 	}
 	if w.Body.String() == "hello world" {
 		t.Errorf("Body set to [%s]; want empty", w.Body.String())
@@ -121,7 +128,7 @@ func TestRouterFilterParam(t *testing.T) {
 		t.Errorf("Body set to [%s]; want empty", w.Body.String())
 	}
 	if w.Code != 400 {
-		t.Errorf("Code set to [%s]; want [%s]", w.Code, http.StatusBadRequest)
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusBadRequest)
 	}
 }
 
@@ -158,7 +165,282 @@ func TestRouterFilterPath(t *testing.T) {
 		t.Errorf("Body set to [%s]; want empty", w.Body.String())
 	}
 	if w.Code != 400 {
-		t.Errorf("Code set to [%s]; want [%s]", w.Code, http.StatusBadRequest)
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusBadRequest)
+	}
+}
+
+// TestRouteWith tests that a route specific filter is only executed for the
+// route it is attached to, after the Router filters.
+func TestRouteWith(t *testing.T) {
+	mux := New()
+	mux.Filter(HandlerSetVar)
+	mux.Get("/person/:last/:first", HandlerOk).With(HandlerErr)
+	mux.Get("/:nickname", HandlerOk)
+
+	// the route filter SHOULD fire and halt the request
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != 400 {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusBadRequest)
+	}
+	if password := context.Get(r).Values.Get("password"); password != "z1on" {
+		t.Errorf("session variable set to [%s]; want [%s]", password, "z1on")
+	}
+
+	// the route filter should not fire for other routes
+	r, _ = http.NewRequest("GET", "/neo", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Body.String() != "hello world" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "hello world")
+	}
+}
+
+// TestRouteAfter tests that the after filters and Context hooks are executed
+// once the request is handled, with the hooks executed in LIFO order.
+func TestRouteAfter(t *testing.T) {
+	var calls []string
+	var code int
+
+	mux := New()
+	mux.Filter(func(w http.ResponseWriter, r *http.Request) {
+		c := context.Get(r)
+		c.OnComplete(func(w http.ResponseWriter, r *http.Request, status int) {
+			calls = append(calls, "first")
+		})
+		c.OnComplete(func(w http.ResponseWriter, r *http.Request, status int) {
+			calls = append(calls, "second")
+		})
+	})
+	mux.After(func(w http.ResponseWriter, r *http.Request, status int) {
+		calls = append(calls, "after")
+		code = status
+	})
+	mux.Get("/person/:last/:first", HandlerOk)
+
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if got := strings.Join(calls, ","); got != "second,first,after" {
+		t.Errorf("hooks executed in order [%s]; want [%s]", got, "second,first,after")
+	}
+	if code != http.StatusOK {
+		t.Errorf("after filter status set to [%v]; want [%v]", code, http.StatusOK)
+	}
+}
+
+// TestRouteAfterPanic tests that the after filters are executed when the
+// request handler panics.
+func TestRouteAfterPanic(t *testing.T) {
+	var code int
+
+	mux := New()
+	mux.After(func(w http.ResponseWriter, r *http.Request, status int) {
+		code = status
+	})
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		panic("there is no spoon")
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if code != http.StatusInternalServerError {
+		t.Errorf("after filter status set to [%v]; want [%v]", code, http.StatusInternalServerError)
+	}
+}
+
+// TestRouteRecover tests that a panic is recovered, reported to the panic
+// hooks, and rendered using the Router's error handler.
+func TestRouteRecover(t *testing.T) {
+	var recovered *Panic
+
+	mux := New()
+	mux.OnPanic(func(r *http.Request, p *Panic) {
+		recovered = p
+	})
+	mux.ErrorHandler(func(w http.ResponseWriter, r *http.Request, code int) {
+		w.WriteHeader(code)
+		fmt.Fprintf(w, "error %d", code)
+	})
+	mux.Get("/person/:last/:first", func(w http.ResponseWriter, r *http.Request) {
+		panic("there is no spoon")
+	})
+
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusInternalServerError)
+	}
+	if w.Body.String() != "error 500" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "error 500")
+	}
+	if recovered == nil {
+		t.Fatalf("panic hook was not invoked")
+	}
+	if recovered.Value != "there is no spoon" {
+		t.Errorf("panic value set to [%v]; want [%v]", recovered.Value, "there is no spoon")
+	}
+	if recovered.Pattern != "/person/:last/:first" {
+		t.Errorf("panic pattern set to [%s]; want [%s]", recovered.Pattern, "/person/:last/:first")
+	}
+
+	// the error handler is also used for routes that are not found
+	r, _ = http.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Body.String() != "error 404" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "error 404")
+	}
+}
+
+// conflictError is a domain error that maps to 409 Conflict.
+type conflictError struct{ name string }
+
+func (e *conflictError) Error() string   { return e.name + " already exists" }
+func (e *conflictError) StatusCode() int { return http.StatusConflict }
+
+// statusError is an error that maps to its own, possibly invalid, code.
+type statusError int
+
+func (e statusError) Error() string   { return "status " + strconv.Itoa(int(e)) }
+func (e statusError) StatusCode() int { return int(e) }
+
+var errNoSpoon = errors.New("there is no spoon")
+
+// TestHandle tests that the errors returned by handlers are mapped to
+// status codes, and rendered with the ErrorFunc.
+func TestHandle(t *testing.T) {
+
+	var reported []error
+	handler := New()
+	handler.MapError(errNoSpoon, http.StatusNotFound)
+	handler.OnError(func(r *http.Request, err error) {
+		reported = append(reported, err)
+	})
+	handler.ErrorHandler(func(w http.ResponseWriter, r *http.Request, code int) {
+		http.Error(w, fmt.Sprintf("error %d", code), code)
+	})
+	handler.Get("/spoon", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("bending: %w", errNoSpoon)
+	}))
+	handler.Get("/user", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("creating user: %w", &conflictError{"neo"})
+	}))
+	handler.Get("/fail", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("connection refused")
+	}))
+	handler.Get("/invalid", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return statusError(0)
+	}))
+	handler.Get("/overflow", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return statusError(1000)
+	}))
+	handler.Get("/written", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		w.Write([]byte("partial"))
+		return errors.New("connection reset")
+	}))
+	handler.Get("/ok", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		w.Write([]byte("ok"))
+		return nil
+	}))
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/spoon", http.StatusNotFound, "error 404\n"},
+		{"/user", http.StatusConflict, "error 409\n"},
+		{"/fail", http.StatusInternalServerError, "error 500\n"},
+		{"/invalid", http.StatusInternalServerError, "error 500\n"},
+		{"/overflow", http.StatusInternalServerError, "error 500\n"},
+		{"/written", http.StatusOK, "partial"},
+		{"/ok", http.StatusOK, "ok"},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", test.path, w.Code, test.code)
+		}
+		if w.Body.String() != test.body {
+			t.Errorf("%s body set to [%s]; want [%s]", test.path, w.Body.String(), test.body)
+		}
+	}
+	if len(reported) != 6 {
+		t.Errorf("Reported [%d] errors; want [%d]", len(reported), 6)
+	}
+}
+
+// TestWriterInterfaces tests that the responseWriter forwards the optional
+// interfaces of the underlying http.ResponseWriter.
+func TestWriterInterfaces(t *testing.T) {
+	mux := New()
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if err := rc.Flush(); err != nil {
+			t.Errorf("Flush returned error [%v]; want nil", err)
+		}
+		if _, _, err := rc.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+			t.Errorf("Hijack returned error [%v]; want [%v]", err, http.ErrNotSupported)
+		}
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Errorf("ResponseWriter does not implement io.ReaderFrom")
+		}
+		io.Copy(w, strings.NewReader("hello world"))
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if !w.Flushed {
+		t.Errorf("ResponseWriter was not flushed")
+	}
+	if w.Body.String() != "hello world" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "hello world")
+	}
+}
+
+// TestResponseInfo tests that the response status, size and route pattern
+// are recorded, and accessible to the after filters.
+func TestResponseInfo(t *testing.T) {
+	mux := New()
+	var info ResponseInfo
+	mux.After(func(w http.ResponseWriter, r *http.Request, status int) {
+		info, _ = Response(w)
+	})
+	mux.Get("/person/:last/:first", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello world")
+	})
+
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if info == nil {
+		t.Fatalf("ResponseInfo not found for the ResponseWriter")
+	}
+	if info.Status() != http.StatusOK {
+		t.Errorf("Status set to [%v]; want [%v]", info.Status(), http.StatusOK)
+	}
+	if info.BytesWritten() != 11 {
+		t.Errorf("BytesWritten set to [%v]; want [%v]", info.BytesWritten(), 11)
+	}
+	if info.Pattern() != "/person/:last/:first" {
+		t.Errorf("Pattern set to [%s]; want [%s]", info.Pattern(), "/person/:last/:first")
 	}
 }
 
@@ -173,7 +455,55 @@ func TestNotFound(t *testing.T) {
 	mux.ServeHTTP(w, r)
 
 	if w.Code != http.StatusNotFound {
-		t.Errorf("Code set to [%s]; want [%s]", w.Code, http.StatusNotFound)
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusNotFound)
+	}
+}
+
+// TestMethodNotAllowed tests that a 405 code is returned, with the allowed
+// methods, if the url only matches routes for other methods.
+func TestMethodNotAllowed(t *testing.T) {
+	mux := New()
+	mux.Get("/person/:name", HandlerOk)
+	mux.Put("/person/:name", HandlerOk)
+	mux.Get("/person/:name/friends", HandlerOk)
+
+	r, _ := http.NewRequest("POST", "/person/neo", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusMethodNotAllowed)
+	}
+	if w.Header().Get("Allow") != "GET, PUT, HEAD" {
+		t.Errorf("Allow set to [%s]; want [%s]", w.Header().Get("Allow"), "GET, PUT, HEAD")
+	}
+}
+
+// TestHead tests that HEAD requests are served by the GET routes, unless a
+// HEAD route matches the url.
+func TestHead(t *testing.T) {
+	mux := New()
+	mux.Get("/person/:name", HandlerOk)
+	mux.Get("/status", HandlerOk)
+	mux.AddRoute("HEAD", "/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Status", "up")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	r, _ := http.NewRequest("HEAD", "/person/neo", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusOK)
+	}
+
+	r, _ = http.NewRequest("HEAD", "/status", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Header().Get("X-Status") != "up" {
+		t.Errorf("X-Status set to [%s]; want [%s]", w.Header().Get("X-Status"), "up")
 	}
 }
 
@@ -225,3 +555,199 @@ func Benchmark_ServeMux(b *testing.B) {
 		mux.ServeHTTP(w, r)
 	}
 }
+
+// TestStaticFS tests the ability to serve static content from a file
+// system, with index files, directory listings and the single-page
+// application fallback
+func TestStaticFS(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":   {Data: []byte("<h1>home</h1>")},
+		"app.js":       {Data: []byte("console.log('app')")},
+		"css/site.css": {Data: []byte("body{}")},
+	}
+
+	handler := New()
+	handler.StaticFS("/static", files, nil)
+	handler.StaticFS("/browse/", files, &StaticOptions{Browse: true})
+	handler.StaticFS("/app", files, &StaticOptions{SPA: true})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/static/css/site.css", http.StatusOK, "body{}"},
+		{"/static/", http.StatusOK, "<h1>home</h1>"},
+		{"/static", http.StatusMovedPermanently, ""},
+		{"/static/css/", http.StatusNotFound, ""},
+		{"/static/../../routes.go", http.StatusNotFound, ""},
+		{"/browse/css/", http.StatusOK, `<a href="site.css">site.css</a>`},
+		{"/app/users/42", http.StatusOK, "<h1>home</h1>"},
+		{"/app/missing.js", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", test.path, w.Code, test.code)
+		}
+		if test.body != "" && !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s body set to [%s]; want [%s]", test.path, w.Body.String(), test.body)
+		}
+	}
+}
+
+// TestStaticPrecompressed tests that precompressed siblings are served to
+// clients that accept their encoding, with the Cache-Control policies.
+func TestStaticPrecompressed(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":         {Data: []byte("<h1>home</h1>")},
+		"assets/app.js":      {Data: []byte("console.log('app')")},
+		"assets/app.js.br":   {Data: []byte("brotli")},
+		"assets/app.js.gz":   {Data: []byte("gzip")},
+		"assets/site.css":    {Data: []byte("body{}")},
+		"assets/site.css.gz": {Data: []byte("gzip")},
+	}
+
+	handler := New()
+	handler.StaticFS("/static", files, &StaticOptions{
+		Precompressed: true,
+		CacheControl: []CachePolicy{
+			{Pattern: "index.html", Value: CacheNoCache},
+			{Pattern: "assets/*", Value: CacheImmutable},
+		},
+	})
+
+	tests := []struct {
+		path     string
+		accept   string
+		body     string
+		encoding string
+		ctype    string
+		cache    string
+	}{
+		{"/static/assets/app.js", "gzip, deflate, br", "brotli", "br", "text/javascript; charset=utf-8", CacheImmutable},
+		{"/static/assets/app.js", "br;q=0.5, gzip", "gzip", "gzip", "text/javascript; charset=utf-8", CacheImmutable},
+		{"/static/assets/app.js", "identity", "console.log('app')", "", "text/javascript; charset=utf-8", CacheImmutable},
+		{"/static/assets/site.css", "br", "body{}", "", "text/css; charset=utf-8", CacheImmutable},
+		{"/static/assets/site.css", "*", "gzip", "gzip", "text/css; charset=utf-8", CacheImmutable},
+		{"/static/", "gzip", "<h1>home</h1>", "", "text/html; charset=utf-8", CacheNoCache},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept-Encoding", test.accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		name := test.path + " " + test.accept
+		if w.Body.String() != test.body {
+			t.Errorf("%s body set to [%s]; want [%s]", name, w.Body.String(), test.body)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("%s Content-Encoding set to [%s]; want [%s]", name, got, test.encoding)
+		}
+		if got := w.Header().Get("Content-Type"); got != test.ctype {
+			t.Errorf("%s Content-Type set to [%s]; want [%s]", name, got, test.ctype)
+		}
+		if got := w.Header().Get("Cache-Control"); got != test.cache {
+			t.Errorf("%s Cache-Control set to [%s]; want [%s]", name, got, test.cache)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s Vary set to [%s]; want [Accept-Encoding]", name, got)
+		}
+	}
+}
+
+// TestStaticHardened tests that static files outside of the root directory
+// are never served, even through symbolic links, and that hidden files and
+// directory listings are not served by default.
+func TestStaticHardened(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "public")
+	files := map[string]string{
+		"secret.txt":                      "secret",
+		"public/app.js":                   "app",
+		"public/.env":                     "TOKEN=secret",
+		"public/.git/config":              "[core]",
+		"public/docs/guide.txt":           "guide",
+		"public/.well-known/security.txt": "contact",
+	}
+	for name, data := range files {
+		file := filepath.Join(base, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		os.WriteFile(file, []byte(data), 0644)
+	}
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(root, "leak.txt")); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+	os.Symlink(base, filepath.Join(root, "parent"))
+	os.Symlink("app.js", filepath.Join(root, "alias.js"))
+
+	handler := New()
+	handler.Static("/static", root)
+	handler.StaticDir("/browse", root, &StaticOptions{Browse: true})
+	handler.StaticDir("/hidden", root, &StaticOptions{Browse: true, Hidden: true})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/static/app.js", http.StatusOK, "app"},
+		{"/static/alias.js", http.StatusOK, "app"},
+		{"/static/static/app.js", http.StatusNotFound, ""},
+		{"/static/../secret.txt", http.StatusNotFound, ""},
+		{"/static/%2e%2e/secret.txt", http.StatusNotFound, ""},
+		{"/static/..%2fsecret.txt", http.StatusNotFound, ""},
+		{"/static/leak.txt", http.StatusNotFound, ""},
+		{"/static/parent/secret.txt", http.StatusNotFound, ""},
+		{"/static/app.js%00.txt", http.StatusNotFound, ""},
+		{"/static/.env", http.StatusNotFound, ""},
+		{"/static/.git/config", http.StatusNotFound, ""},
+		{"/static/.git/", http.StatusNotFound, ""},
+		{"/static/docs/", http.StatusNotFound, ""},
+		{"/browse/docs/", http.StatusOK, "guide.txt"},
+		{"/browse/.git/", http.StatusNotFound, ""},
+		{"/hidden/.well-known/security.txt", http.StatusOK, "contact"},
+		{"/hidden/parent/secret.txt", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", test.path, w.Code, test.code)
+		}
+		if test.body != "" && !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s body set to [%s]; want [%s]", test.path, w.Body.String(), test.body)
+		}
+		if strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("%s body set to [%s]; want no secret", test.path, w.Body.String())
+		}
+	}
+
+	// hidden files are not listed
+	r, _ := http.NewRequest("GET", "/browse/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if body := w.Body.String(); !strings.Contains(body, "app.js") || strings.Contains(body, ".env") || strings.Contains(body, ".git") {
+		t.Errorf("Listing set to [%s]; want no hidden files", body)
+	}
+}
+
+// TestStaticMissing tests that Static panics when the directory cannot be
+// opened, rather than serving 404 for every request.
+func TestStaticMissing(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Static did not panic for a missing directory")
+		}
+	}()
+	New().Static("/static", filepath.Join(t.TempDir(), "missing"))
+}
@@ -0,0 +1,43 @@
+package routes
+
+import "text/template"
+
+// Asset returns the fingerprinted URL of a file served by StaticFS with the
+// Fingerprint option, given its name relative to the root of the file
+// system, or its URL path. For example "css/site.css" and
+// "/static/css/site.css" both return "/static/css/site.3f9a2c1b.css". The
+// names of files that are not fingerprinted are returned unchanged.
+//
+// Asset is available to the templates of the Router as the asset function:
+//
+//	<link rel="stylesheet" href="{{ asset "css/site.css" }}">
+func (r *Router) Asset(name string) string {
+	r.RLock()
+	defer r.RUnlock()
+	return r.asset(name)
+}
+
+// asset returns the fingerprinted URL of the file. The Router must be
+// locked by the caller.
+func (r *Router) asset(name string) string {
+	for _, s := range r.assets {
+		if url, ok := s.Asset(name); ok {
+			return url
+		}
+	}
+	return name
+}
+
+// TemplateFuncs returns the functions available to the templates of the
+// Router, such as asset. TemplateFiles and TemplateGlob add them before the
+// templates are parsed; templates given to Template must add them the same
+// way:
+//
+//	t := template.New("").Funcs(r.TemplateFuncs())
+//	r.Template(template.Must(t.ParseFS(views, "*.html")))
+//
+// The functions must only be called by templates executed by ServeTemplate,
+// which locks the Router.
+func (r *Router) TemplateFuncs() template.FuncMap {
+	return template.FuncMap{"asset": r.asset}
+}
@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"text/template"
+)
+
+// TestAsset tests that fingerprinted files are served at their hashed URLs
+// with immutable caching, and at their original URLs.
+func TestAsset(t *testing.T) {
+	files := fstest.MapFS{
+		"css/site.css": {Data: []byte("body{}")},
+		"favicon":      {Data: []byte("icon")},
+		".env":         {Data: []byte("TOKEN=secret")},
+	}
+	hash := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:4])
+	}
+	site := "/static/css/site." + hash("body{}") + ".css"
+
+	mux := NewRouter()
+	mux.StaticFS("/static", files, &StaticOptions{Fingerprint: true})
+
+	assets := []struct {
+		name string
+		url  string
+	}{
+		{"css/site.css", site},
+		{"/static/css/site.css", site},
+		{"favicon", "/static/favicon." + hash("icon")},
+		{"css/missing.css", "css/missing.css"},
+		{"/other/css/site.css", "/other/css/site.css"},
+		{".env", ".env"},
+	}
+	for _, test := range assets {
+		if got := mux.Asset(test.name); got != test.url {
+			t.Errorf("Asset %s set to [%s]; want [%s]", test.name, got, test.url)
+		}
+	}
+
+	tests := []struct {
+		path  string
+		code  int
+		cache string
+	}{
+		{site, http.StatusOK, CacheImmutable},
+		{"/static/css/site.css", http.StatusOK, ""},
+		{"/static/css/site.00000000.css", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", test.path, w.Code, test.code)
+		}
+		if got := w.Header().Get("Cache-Control"); got != test.cache {
+			t.Errorf("%s Cache-Control set to [%s]; want [%s]", test.path, got, test.cache)
+		}
+		if test.code == http.StatusOK && w.Body.String() != "body{}" {
+			t.Errorf("%s body set to [%s]; want [body{}]", test.path, w.Body.String())
+		}
+	}
+}
+
+// TestAssetTemplate tests that the asset function is available to the
+// templates of the Router.
+func TestAssetTemplate(t *testing.T) {
+	files := fstest.MapFS{"site.css": {Data: []byte("body{}")}}
+	page := filepath.Join(t.TempDir(), "page.html")
+	os.WriteFile(page, []byte(`<link href="{{ asset "site.css" }}">`), 0644)
+
+	mux := NewRouter()
+	mux.StaticFS("/static", files, &StaticOptions{Fingerprint: true})
+	mux.Get("/:name", func(w http.ResponseWriter, r *http.Request) {
+		ServeTemplate(w, NewContext(r).Params.Get("name"), nil)
+	})
+	want := `<link href="` + mux.Asset("site.css") + `">`
+
+	// templates parsed by the Router
+	mux.TemplateFiles(page)
+	r, _ := http.NewRequest("GET", "/page.html", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Body.String() != want {
+		t.Errorf("TemplateFiles body set to [%s]; want [%s]", w.Body.String(), want)
+	}
+
+	// templates parsed by the application
+	views := template.Must(template.New("page").Funcs(mux.TemplateFuncs()).Parse(`<link href="{{ asset "/static/site.css" }}">`))
+	mux.Template(views)
+	views.Parse(`changed`)
+	r, _ = http.NewRequest("GET", "/page", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Body.String() != want {
+		t.Errorf("Template body set to [%s]; want [%s]", w.Body.String(), want)
+	}
+}
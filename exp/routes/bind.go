@@ -0,0 +1,304 @@
+package routes
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone/routes/internal/header"
+)
+
+// Bind binds the request to the value pointed to by v. The body is decoded
+// as Read does, except that an empty body, such as the body of a GET
+// request, is not an error.
+//
+// If v points to a struct, its fields are also set from the request with
+// the following struct tags, which take precedence over the body:
+//
+//	path:"id"          the URL parameter
+//	query:"page"       the query string parameter
+//	header:"X-Tenant"  the request header
+//	form:"name"        the value of a URL encoded or multipart form body
+//
+// Values are converted to strings, bools, ints, uints, floats,
+// time.Duration, time.Time (RFC 3339) and types that implement
+// encoding.TextUnmarshaler, and to slices of these from repeated values.
+// Nested structs are bound recursively.
+//
+// Values that cannot be converted, and a malformed body, are reported
+// together in a BindError. A BodyTooLargeError or MediaTypeError is
+// returned on its own.
+func Bind(r *http.Request, v interface{}) error {
+	var errs BindError
+
+	mediaType, _ := header.ParseMediaType(r.Header.Get("Content-Type"))
+	var form url.Values
+	switch mediaType {
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		var err error
+		if form, err = readForm(r); err != nil {
+			return err
+		}
+	case "":
+		if noBody(r) {
+			// nothing to decode, such as the body of a GET request
+			break
+		}
+		fallthrough
+	default:
+		if err := Read(r, v); err != nil && err != io.EOF {
+			d, ok := err.(*DecodeError)
+			if !ok {
+				return err
+			}
+			errs = append(errs, &FieldError{Field: d.Field, Source: "body", Err: d})
+		}
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct {
+		b := binder{req: r, params: NewContext(r).Params, query: r.URL.Query(), form: form}
+		b.bind(rv.Elem(), "")
+		errs = append(errs, b.errs...)
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// readForm decodes a URL encoded or multipart form body, with the size limit
+// of the DecodeOptions. Uploaded files are discarded.
+func readForm(r *http.Request) (url.Values, error) {
+	opts := decodingOf(r)
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, &DecodeError{Err: err}
+	}
+	if mediaType == "application/x-www-form-urlencoded" {
+		var form url.Values
+		err := decode(r, FormCodec{}, &form, opts)
+		return form, err
+	}
+
+	var form *multipart.Form
+	err = decode(r, multipartCodec(params["boundary"]), &form, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer form.RemoveAll()
+	return url.Values(form.Value), nil
+}
+
+// multipartCodec decodes a multipart form with the boundary into a pointer
+// to a *multipart.Form.
+type multipartCodec string
+
+func (c multipartCodec) Encode(w io.Writer, v interface{}) error {
+	return fmt.Errorf("routes: cannot encode %T as a multipart form", v)
+}
+
+func (c multipartCodec) Decode(r io.Reader, v interface{}) error {
+	form, err := multipart.NewReader(r, string(c)).ReadForm(32 << 20)
+	if err != nil {
+		return &DecodeError{Err: err}
+	}
+	*v.(**multipart.Form) = form
+	return nil
+}
+
+// BindError lists the fields of the request that could not be bound.
+type BindError []*FieldError
+
+func (e BindError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "routes: cannot bind request: " + strings.Join(msgs, "; ")
+}
+
+// StatusCode returns 400 Bad Request.
+func (e BindError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// FieldError describes a request value that could not be bound to a field.
+type FieldError struct {
+	Field  string // the path of the struct field, by its json or form name, such as address.city
+	Source string // the source of the value: path, query, header, form or body
+	Name   string // the name of the parameter or header
+	Value  string // the value that could not be converted
+	Err    error  // the underlying error
+}
+
+func (e *FieldError) Error() string {
+	if e.Source == "body" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s %s %q: invalid value %q: %v", e.Source, e.Field, e.Name, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// binder sets the fields of a struct from the request.
+type binder struct {
+	req    *http.Request
+	params Params
+	query  url.Values
+	form   url.Values
+	errs   BindError
+}
+
+// bind sets the fields of the struct. The prefix is the path of the struct
+// within the value being bound.
+func (b *binder) bind(v reflect.Value, prefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		path := prefix + fieldName(field)
+
+		source, name, values := b.lookup(field)
+		if source == "" {
+			// bind the fields of nested structs, unless they are a value
+			// such as a time.Time
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Struct && !isScalar(fv) {
+				b.bind(fv, path+".")
+			}
+			continue
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(v.Field(i), values); err != nil {
+			if n, ok := err.(*strconv.NumError); ok {
+				err = n.Err
+			}
+			b.errs = append(b.errs, &FieldError{
+				Field:  path,
+				Source: source,
+				Name:   name,
+				Value:  strings.Join(values, ","),
+				Err:    err,
+			})
+		}
+	}
+}
+
+// lookup returns the source, name and values of the field, as given by its
+// struct tags.
+func (b *binder) lookup(field reflect.StructField) (string, string, []string) {
+	if name, ok := field.Tag.Lookup("path"); ok && name != "-" {
+		if value, ok := b.params[name]; ok {
+			return "path", name, []string{value}
+		}
+		return "path", name, nil
+	}
+	if name, ok := field.Tag.Lookup("query"); ok && name != "-" {
+		return "query", name, b.query[name]
+	}
+	if name, ok := field.Tag.Lookup("header"); ok && name != "-" {
+		return "header", name, b.req.Header.Values(name)
+	}
+	if name, ok := field.Tag.Lookup("form"); ok && name != "-" {
+		return "form", name, b.form[name]
+	}
+	return "", "", nil
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isScalar reports whether the value is set from a single string, rather
+// than having its fields bound.
+func isScalar(v reflect.Value) bool {
+	return reflect.PointerTo(v.Type()).Implements(textUnmarshalerType)
+}
+
+// setField sets the field from the values. Slices are set from all the
+// values, and other types from the first value.
+func setField(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && !isScalar(v) {
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setValue(v, values[0])
+}
+
+// setValue converts the string to the type of the value, and sets it.
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindAddress struct {
+	City string `query:"city"`
+}
+
+type bindRequest struct {
+	ID      int           `path:"id"`
+	Page    *uint         `query:"page"`
+	Tags    []string      `query:"tag"`
+	Active  bool          `query:"active"`
+	Since   time.Time     `query:"since"`
+	Timeout time.Duration `query:"timeout"`
+	IP      net.IP        `query:"ip"`
+	Tenant  string        `header:"X-Tenant"`
+	Name    string        `json:"name" form:"name"`
+	Age     float64       `json:"age" form:"age"`
+	Address bindAddress
+}
+
+// bindServe serves the request with a route that binds it, and returns the
+// bound value and error.
+func bindServe(r *http.Request) (*bindRequest, error) {
+	var v bindRequest
+	var err error
+	mux := NewRouter()
+	mux.AddRoute(r.Method, "/people/:id", func(w http.ResponseWriter, r *http.Request) {
+		err = Bind(r, &v)
+	})
+	mux.ServeHTTP(httptest.NewRecorder(), r)
+	return &v, err
+}
+
+// TestBindStruct tests that struct fields are bound from the path, query,
+// headers and JSON body.
+func TestBindStruct(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/people/42?page=3&tag=a&tag=b&active=true&since=2024-01-02T03:04:05Z&timeout=1m30s&ip=10.0.0.1&city=Zion", strings.NewReader(`{"name":"Morpheus","age":42.5}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Tenant", "nebuchadnezzar")
+	v, err := bindServe(r)
+	if err != nil {
+		t.Fatalf("Bind returned [%v]; want nil", err)
+	}
+
+	if v.ID != 42 {
+		t.Errorf("ID set to [%v]; want [%v]", v.ID, 42)
+	}
+	if v.Page == nil || *v.Page != 3 {
+		t.Errorf("Page set to [%v]; want [%v]", v.Page, 3)
+	}
+	if strings.Join(v.Tags, ",") != "a,b" {
+		t.Errorf("Tags set to [%v]; want [%v]", v.Tags, "[a b]")
+	}
+	if !v.Active {
+		t.Errorf("Active set to [%v]; want [%v]", v.Active, true)
+	}
+	if !v.Since.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Since set to [%v]; want [%v]", v.Since, "2024-01-02T03:04:05Z")
+	}
+	if v.Timeout != 90*time.Second {
+		t.Errorf("Timeout set to [%v]; want [%v]", v.Timeout, 90*time.Second)
+	}
+	if v.IP.String() != "10.0.0.1" {
+		t.Errorf("IP set to [%v]; want [%v]", v.IP, "10.0.0.1")
+	}
+	if v.Tenant != "nebuchadnezzar" {
+		t.Errorf("Tenant set to [%v]; want [%v]", v.Tenant, "nebuchadnezzar")
+	}
+	if v.Name != "Morpheus" || v.Age != 42.5 {
+		t.Errorf("Body set to [%v %v]; want [%v %v]", v.Name, v.Age, "Morpheus", 42.5)
+	}
+	if v.Address.City != "Zion" {
+		t.Errorf("Address.City set to [%v]; want [%v]", v.Address.City, "Zion")
+	}
+}
+
+// TestBindForm tests that struct fields are bound from URL encoded and
+// multipart forms.
+func TestBindForm(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/people/1", strings.NewReader("name=Trinity&age=30"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	v, err := bindServe(r)
+	if err != nil {
+		t.Fatalf("Bind returned [%v]; want nil", err)
+	}
+	if v.Name != "Trinity" || v.Age != 30 {
+		t.Errorf("Form set to [%v %v]; want [%v %v]", v.Name, v.Age, "Trinity", 30)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "Neo")
+	mw.WriteField("age", "33")
+	mw.Close()
+	r, _ = http.NewRequest("POST", "/people/1", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	v, err = bindServe(r)
+	if err != nil {
+		t.Fatalf("Bind returned [%v]; want nil", err)
+	}
+	if v.Name != "Neo" || v.Age != 33 {
+		t.Errorf("Form set to [%v %v]; want [%v %v]", v.Name, v.Age, "Neo", 33)
+	}
+}
+
+// TestBindErrors tests that conversion errors are aggregated per field.
+func TestBindErrors(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/people/abc?page=-1&since=yesterday&city=Zion", strings.NewReader(`{"age":"old"}`))
+	r.Header.Set("Content-Type", "application/json")
+	_, err := bindServe(r)
+
+	var errs BindError
+	if !errors.As(err, &errs) {
+		t.Fatalf("Bind returned [%v]; want a BindError", err)
+	}
+	if errs.StatusCode() != http.StatusBadRequest {
+		t.Errorf("StatusCode set to [%v]; want [%v]", errs.StatusCode(), http.StatusBadRequest)
+	}
+
+	want := map[string]string{"age": "body", "ID": "path", "Page": "query", "Since": "query"}
+	if len(errs) != len(want) {
+		t.Fatalf("Bind returned [%d] errors; want [%d]: %v", len(errs), len(want), err)
+	}
+	for _, e := range errs {
+		if want[e.Field] != e.Source {
+			t.Errorf("Field [%s] source set to [%s]; want [%s]", e.Field, e.Source, want[e.Field])
+		}
+	}
+	if errs[1].Name != "id" || errs[1].Value != "abc" {
+		t.Errorf("Path error set to [%s=%s]; want [%s=%s]", errs[1].Name, errs[1].Value, "id", "abc")
+	}
+
+	r, _ = http.NewRequest("POST", "/people/1", strings.NewReader("name=Neo"))
+	r.Header.Set("Content-Type", "text/plain")
+	if _, err := bindServe(r); !errors.Is(err, ErrUnsupportedMediaType) {
+		t.Errorf("Bind returned [%v]; want [%v]", err, ErrUnsupportedMediaType)
+	}
+}
+
+// TestBind tests that an empty body is not an error.
+func TestBind(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	NewContext(r)
+	var person struct{ Name string }
+	if err := Bind(r, &person); err != nil {
+		t.Errorf("Bind returned [%v]; want nil", err)
+	}
+}
+
+// TestBindNoBody tests that a request without a body is not decoded, so that
+// it is not rejected when a Content-Type is required.
+func TestBindNoBody(t *testing.T) {
+	mux := NewRouter()
+	mux.Decoding(DecodeOptions{RequireContentType: true})
+	mux.Get("/:name", func(w http.ResponseWriter, r *http.Request) {
+		var person struct {
+			Name string `path:"name"`
+		}
+		if err := Bind(r, &person); err != nil {
+			t.Errorf("Bind returned [%v]; want nil", err)
+		}
+		w.Write([]byte(person.Name))
+	})
+
+	r, _ := http.NewRequest("GET", "/trinity", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "trinity" {
+		t.Errorf("GET set to [%v %s]; want [%v trinity]", w.Code, w.Body.String(), http.StatusOK)
+	}
+}
@@ -0,0 +1,319 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/drone/routes/internal/header"
+)
+
+// Key used to store the codecs of the Router in the Context
+const codecsKey = "_codecs"
+
+// Codec encodes and decodes the representation of resources in a media
+// type, for example JSON or CSV. Codecs are registered on the Router with
+// the Codec method, and used by ServeFormatted, Read and Bind.
+type Codec interface {
+	// Encode writes the representation of v to w.
+	Encode(w io.Writer, v interface{}) error
+
+	// Decode parses the representation read from r, and stores the result
+	// in the value pointed to by v.
+	Decode(r io.Reader, v interface{}) error
+}
+
+// codec is a Codec registered for a media type.
+type codec struct {
+	mediaType   string // the media type, without parameters
+	contentType string // the Content-Type of encoded responses
+	decodeOnly  bool   // the codec is not offered by ServeFormatted
+	Codec
+}
+
+// defaultCodecs are the codecs registered on a new Router, in order of
+// preference. They are also used by requests that are not served by a
+// Router. Forms are only decoded by default, since most resources cannot be
+// encoded as a form.
+var defaultCodecs = []codec{
+	newCodec("application/json", JsonCodec{}),
+	newCodec("application/xml; charset=utf-8", XmlCodec{}),
+	newCodec("text/xml; charset=utf-8", XmlCodec{}),
+	{mediaType: "application/x-www-form-urlencoded", contentType: "application/x-www-form-urlencoded", decodeOnly: true, Codec: FormCodec{}},
+}
+
+func newCodec(contentType string, c Codec) codec {
+	mediaType, _ := header.ParseMediaType(contentType)
+	return codec{mediaType: mediaType, contentType: contentType, Codec: c}
+}
+
+// Codec registers the Codec for the media type, replacing any Codec
+// registered for the same media type. The media type may include
+// parameters, such as "text/csv; charset=utf-8", which are added to the
+// Content-Type of encoded responses. When the client accepts several media
+// types equally, ServeFormatted prefers the codecs in the order they were
+// registered, after the default JSON and XML codecs. The default form codec
+// only decodes requests; registering FormCodec for its media type enables
+// form responses too.
+func (r *Router) Codec(mediaType string, c Codec) {
+	r.Lock()
+	defer r.Unlock()
+
+	// the list is copied, since requests being served hold a reference
+	entry := newCodec(mediaType, c)
+	codecs := make([]codec, 0, len(r.codecs)+1)
+	replaced := false
+	for _, existing := range r.codecs {
+		if existing.mediaType == entry.mediaType {
+			existing, replaced = entry, true
+		}
+		codecs = append(codecs, existing)
+	}
+	if !replaced {
+		codecs = append(codecs, entry)
+	}
+	r.codecs = codecs
+}
+
+// codecsOf returns the codecs of the Router serving the request.
+func codecsOf(r *http.Request) []codec {
+	if codecs, ok := NewContext(r).Values.Get(codecsKey).([]codec); ok {
+		return codecs
+	}
+	return defaultCodecs
+}
+
+// ServeFormatted writes the representation of resource v in the format
+// requested by the client in the Accept header, using the codecs registered
+// on the Router. JSON is served if the client accepts several formats
+// equally. If the client accepts none of the formats, a 406 Not Acceptable
+// error is written with the list of supported types.
+func ServeFormatted(w http.ResponseWriter, r *http.Request, v interface{}) {
+	serveFormatted(w, r, http.StatusOK, v)
+}
+
+// serveFormatted writes the representation of resource v with the status
+// code, in the format negotiated by ServeFormatted. Error responses fall back
+// to the preferred format, rather than a 406 Not Acceptable error.
+func serveFormatted(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	var codecs []codec
+	for _, c := range codecsOf(r) {
+		if !c.decodeOnly {
+			codecs = append(codecs, c)
+		}
+	}
+	offers := make([]string, len(codecs))
+	for i, c := range codecs {
+		offers[i] = c.contentType
+	}
+	match := Negotiate(r, offers...)
+	if match == "" && code >= 400 && len(codecs) != 0 {
+		match = codecs[0].contentType
+	}
+
+	for _, c := range codecs {
+		if c.contentType != match {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := c.Encode(&buf, v); err != nil {
+			serveError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeContent(w, code, c.contentType, buf.Bytes())
+		return
+	}
+
+	types := make([]string, len(codecs))
+	for i, c := range codecs {
+		types[i] = c.mediaType
+	}
+	NotAcceptable(w, types...)
+}
+
+// Read decodes the request body, using the Codec registered on the Router
+// for the Content-Type of the request, and stores the result in the value
+// pointed to by v. If the request has no Content-Type, the body is decoded
+// as JSON, unless DecodeOptions require a Content-Type. A MediaTypeError is
+// returned if no Codec is registered for the Content-Type.
+func Read(r *http.Request, v interface{}) error {
+	opts := decodingOf(r)
+	codecs := codecsOf(r)
+	mediaType, err := checkContentType(r, opts, func(mediaType string) bool {
+		return lookup(codecs, mediaType) != nil
+	})
+	if err != nil {
+		return err
+	}
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	if c := lookup(codecs, mediaType); c != nil {
+		return decode(r, c, v, opts)
+	}
+	return &MediaTypeError{MediaType: mediaType}
+}
+
+// lookup returns the Codec registered for the media type, or nil.
+func lookup(codecs []codec, mediaType string) Codec {
+	for _, c := range codecs {
+		if c.mediaType == mediaType {
+			return c.Codec
+		}
+	}
+	return nil
+}
+
+// Codecs ----------------------------------------------------------------------
+
+// JsonCodec encodes and decodes JSON, as served by ServeJson.
+type JsonCodec struct{}
+
+func (JsonCodec) Encode(w io.Writer, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+func (c JsonCodec) Decode(r io.Reader, v interface{}) error {
+	return c.DecodeStrict(r, v, DecodeOptions{})
+}
+
+// XmlCodec encodes and decodes XML, as served by ServeXml.
+type XmlCodec struct{}
+
+func (XmlCodec) Encode(w io.Writer, v interface{}) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func (c XmlCodec) Decode(r io.Reader, v interface{}) error {
+	return c.DecodeStrict(r, v, DecodeOptions{})
+}
+
+// FormCodec encodes and decodes URL encoded forms. It encodes url.Values,
+// map[string]string and map[string][]string values, and decodes into
+// pointers to these types.
+type FormCodec struct{}
+
+func (FormCodec) Encode(w io.Writer, v interface{}) error {
+	var values url.Values
+	switch v := v.(type) {
+	case url.Values:
+		values = v
+	case map[string][]string:
+		values = v
+	case map[string]string:
+		values = make(url.Values, len(v))
+		for key, val := range v {
+			values.Set(key, val)
+		}
+	default:
+		return fmt.Errorf("routes: cannot encode %T as a form", v)
+	}
+	_, err := io.WriteString(w, values.Encode())
+	return err
+}
+
+func (FormCodec) Decode(r io.Reader, v interface{}) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case *url.Values:
+		*v = values
+	case *map[string][]string:
+		*v = values
+	case *map[string]string:
+		if *v == nil {
+			*v = make(map[string]string, len(values))
+		}
+		for key := range values {
+			(*v)[key] = values.Get(key)
+		}
+	default:
+		return fmt.Errorf("routes: cannot decode a form into %T", v)
+	}
+	return nil
+}
+
+// NdjsonCodec encodes and decodes newline delimited JSON. A slice is
+// encoded with one element per line, and the lines are decoded by appending
+// to the slice pointed to by v.
+type NdjsonCodec struct{}
+
+func (NdjsonCodec) Encode(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return enc.Encode(v)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (NdjsonCodec) Decode(r io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("routes: cannot decode newline delimited JSON into %T", v)
+	}
+	slice := rv.Elem()
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		elem := reflect.New(slice.Type().Elem())
+		if err := dec.Decode(elem.Interface()); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+}
+
+// CsvCodec encodes and decodes comma separated values. It encodes [][]string
+// values, and decodes into a pointer to [][]string.
+type CsvCodec struct{}
+
+func (CsvCodec) Encode(w io.Writer, v interface{}) error {
+	records, ok := v.([][]string)
+	if !ok {
+		return fmt.Errorf("routes: cannot encode %T as CSV", v)
+	}
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+func (CsvCodec) Decode(r io.Reader, v interface{}) error {
+	records, ok := v.(*[][]string)
+	if !ok {
+		return fmt.Errorf("routes: cannot decode CSV into %T", v)
+	}
+	all, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	*records = all
+	return nil
+}
@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestCodec tests that codecs registered on the Router are used to serve
+// and read the negotiated media types.
+func TestCodec(t *testing.T) {
+	mux := NewRouter()
+	mux.Codec("text/csv; charset=utf-8", CsvCodec{})
+	mux.Get("/people", func(w http.ResponseWriter, r *http.Request) {
+		ServeFormatted(w, r, [][]string{{"first", "last"}, {"Thomas", "Anderson"}})
+	})
+	mux.Post("/people", func(w http.ResponseWriter, r *http.Request) {
+		var records [][]string
+		if err := Read(r, &records); err != nil {
+			serveError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(records[1][0]))
+	})
+
+	r, _ := http.NewRequest("GET", "/people", nil)
+	r.Header.Set("Accept", "text/html, text/csv;q=0.9")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type set to [%s]; want [%s]", w.Header().Get("Content-Type"), "text/csv; charset=utf-8")
+	}
+	if w.Body.String() != "first,last\nThomas,Anderson\n" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "first,last\nThomas,Anderson\n")
+	}
+
+	r, _ = http.NewRequest("POST", "/people", strings.NewReader("first,last\nTrinity,\n"))
+	r.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Body.String() != "Trinity" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "Trinity")
+	}
+}
+
+// TestCodecReplace tests that registering a codec for an existing media
+// type replaces it.
+func TestCodecReplace(t *testing.T) {
+	mux := NewRouter()
+	mux.Codec("application/json", NdjsonCodec{})
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		ServeFormatted(w, r, []int{1, 2})
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Body.String() != "1\n2\n" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "1\n2\n")
+	}
+	if len(mux.codecs) != len(defaultCodecs) {
+		t.Errorf("Codecs set to [%d]; want [%d]", len(mux.codecs), len(defaultCodecs))
+	}
+}
+
+// TestCodecDecodeOnly tests that forms are not offered by ServeFormatted
+// unless FormCodec is registered.
+func TestCodecDecodeOnly(t *testing.T) {
+	mux := NewRouter()
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		ServeFormatted(w, r, url.Values{"name": {"Morpheus"}})
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusNotAcceptable)
+	}
+
+	mux.Codec("application/x-www-form-urlencoded", FormCodec{})
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Body.String() != "name=Morpheus" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "name=Morpheus")
+	}
+}
+
+// TestRead tests that the request body is decoded with the codec for its
+// Content-Type.
+func TestRead(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/", strings.NewReader("name=Morpheus&ship=Nebuchadnezzar"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var form url.Values
+	if err := Read(r, &form); err != nil {
+		t.Fatalf("Read returned [%v]; want nil", err)
+	}
+	if form.Get("ship") != "Nebuchadnezzar" {
+		t.Errorf("ship set to [%s]; want [%s]", form.Get("ship"), "Nebuchadnezzar")
+	}
+
+	r, _ = http.NewRequest("POST", "/", strings.NewReader(`{"Name":"Morpheus"}`))
+	var person struct{ Name string }
+	if err := Read(r, &person); err != nil {
+		t.Fatalf("Read returned [%v]; want nil", err)
+	}
+	if person.Name != "Morpheus" {
+		t.Errorf("Name set to [%s]; want [%s]", person.Name, "Morpheus")
+	}
+
+	r, _ = http.NewRequest("POST", "/", strings.NewReader("{\"n\":1}\n{\"n\":2}\n"))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	if err := Read(r, &person); !errors.Is(err, ErrUnsupportedMediaType) {
+		t.Errorf("Read returned [%v]; want [%v]", err, ErrUnsupportedMediaType)
+	}
+}
+
+// TestNdjsonCodec tests that newline delimited JSON is decoded by appending
+// to a slice.
+func TestNdjsonCodec(t *testing.T) {
+	var values []struct{ N int }
+	if err := (NdjsonCodec{}).Decode(strings.NewReader("{\"N\":1}\n{\"N\":2}\n"), &values); err != nil {
+		t.Fatalf("Decode returned [%v]; want nil", err)
+	}
+	if len(values) != 2 || values[1].N != 2 {
+		t.Errorf("Decoded [%v]; want [%v]", values, "[{1} {2}]")
+	}
+}
@@ -0,0 +1,312 @@
+package routes
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/drone/routes/internal/header"
+)
+
+// DefaultCompressMinSize is the default minimum size of the responses
+// compressed by the Compress middleware.
+const DefaultCompressMinSize = 1024
+
+// defaultCompressTypes are the media types compressed by default.
+var defaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/x-ndjson",
+	"application/javascript",
+	"application/xml",
+	"application/*+xml",
+	"image/svg+xml",
+}
+
+// Compress is a middleware that compresses responses with gzip or deflate,
+// as negotiated with the Accept-Encoding header of the request. It is added
+// to the Router with the Use method:
+//
+//	r.Use(&routes.Compress{MinSize: 1400})
+//
+// The response is buffered until MinSize bytes are written, so that small
+// responses are sent uncompressed. Responses with a Content-Length below
+// MinSize, or that are already encoded, are never compressed. Flushing the
+// response, for example to stream events, starts the compression
+// regardless of its size.
+//
+// The Content-Length of compressed responses, such as the one set by
+// ServeJson, is removed, and strong ETags are made weak. BytesWritten
+// reports the size of the response before compression.
+type Compress struct {
+	// MinSize is the minimum size of the responses that are compressed, in
+	// bytes. If zero, DefaultCompressMinSize is used.
+	MinSize int
+
+	// Level is the compression level, as defined by compress/flate. If
+	// zero, the default compression level is used.
+	Level int
+
+	// Types are the media types that are compressed, which may contain
+	// wildcards such as text/* or application/*+json. If empty, text,
+	// JSON, JavaScript, XML and SVG are compressed.
+	Types []string
+
+	// ExcludeTypes are the media types that are never compressed, even if
+	// they match Types, for example text/event-stream.
+	ExcludeTypes []string
+}
+
+// Filter negotiates the encoding of the response, and wraps the writer of
+// the Router to compress the response. Vary: Accept-Encoding is added to
+// every response, since its encoding depends on the request.
+func (m *Compress) Filter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	rw := unwrap(w)
+	encoding := acceptEncoding(r.Header.Values("Accept-Encoding"))
+	if rw == nil || encoding == "" {
+		return
+	}
+	rw.writer = &compressWriter{ResponseWriter: rw.writer, m: m, encoding: encoding}
+}
+
+// After completes the compressed response, writing any buffered data.
+func (m *Compress) After(w http.ResponseWriter, r *http.Request, status int) {
+	rw := unwrap(w)
+	if rw == nil {
+		return
+	}
+	if cw, ok := rw.writer.(*compressWriter); ok {
+		cw.close()
+	}
+}
+
+func (m *Compress) minSize() int {
+	if m.MinSize == 0 {
+		return DefaultCompressMinSize
+	}
+	return m.MinSize
+}
+
+func (m *Compress) level() int {
+	if m.Level == 0 {
+		return gzip.DefaultCompression
+	}
+	return m.Level
+}
+
+// compressible reports whether responses of the media type are compressed.
+func (m *Compress) compressible(contentType string) bool {
+	mediaType, _ := header.ParseMediaType(contentType)
+	if mediaType == "" || matchTypes(m.ExcludeTypes, mediaType) {
+		return false
+	}
+	if len(m.Types) == 0 {
+		return matchTypes(defaultCompressTypes, mediaType)
+	}
+	return matchTypes(m.Types, mediaType)
+}
+
+// matchTypes reports whether the media type matches one of the patterns.
+func matchTypes(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptEncoding returns the encoding with the highest quality value in the
+// Accept-Encoding header values, preferring gzip to deflate. It returns an
+// empty string if neither is acceptable.
+func acceptEncoding(values []string) string {
+	qs := header.ParseAcceptEncoding(values)
+	best, bestq := "", 0.0
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if q := header.EncodingQuality(qs, encoding); q > bestq {
+			best, bestq = encoding, q
+		}
+	}
+	return best
+}
+
+// encoder is a gzip or zlib writer.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter compresses the response written to the underlying writer.
+// It buffers the response until it is known whether it is compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	m        *Compress
+	encoding string
+	code     int     // the status code, or 0 if not written yet
+	buf      []byte  // the data buffered until the response is started
+	started  bool    // the header was written to the underlying writer
+	enc      encoder // the encoder, if the response is compressed
+}
+
+// WriteHeader records the status code. The header is written once the size
+// of the response is known, or with the first data written.
+func (w *compressWriter) WriteHeader(code int) {
+	if w.started || w.code != 0 {
+		return
+	}
+	if code < 200 {
+		// informational responses are sent as is
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+	if w.Header().Get("Content-Length") != "" || !bodyAllowed(code) {
+		w.start(false)
+	}
+}
+
+// Write buffers the data until MinSize bytes are written, or the length of
+// the response is known, then writes it compressed if possible.
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.started {
+		return w.write(p)
+	}
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) < w.m.minSize() && w.Header().Get("Content-Length") == "" {
+		return len(p), nil
+	}
+	if err := w.start(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *compressWriter) write(p []byte) (int, error) {
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// start decides whether the response is compressed, writes the header and
+// the buffered data. The response is complete if final is true, and
+// streamed if it is flushed before MinSize bytes are written.
+func (w *compressWriter) start(final bool) error {
+	w.started = true
+	if w.compress(final) {
+		h := w.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		if w.encoding == "gzip" {
+			w.enc, _ = gzip.NewWriterLevel(w.ResponseWriter, w.m.level())
+		} else {
+			w.enc, _ = zlib.NewWriterLevel(w.ResponseWriter, w.m.level())
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.write(buf)
+	return err
+}
+
+// compress reports whether the response is compressed.
+func (w *compressWriter) compress(final bool) bool {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" || !bodyAllowed(w.code) || w.code == http.StatusPartialContent {
+		return false
+	}
+	if _, ok := h["Content-Type"]; !ok {
+		if len(w.buf) == 0 {
+			return false
+		}
+		// sniff the content type before the body is compressed
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if !w.m.compressible(h.Get("Content-Type")) {
+		return false
+	}
+	if cl := h.Get("Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		return err == nil && n >= int64(w.m.minSize())
+	}
+	return !final || len(w.buf) >= w.m.minSize()
+}
+
+// close writes the buffered data, and completes the compressed stream.
+func (w *compressWriter) close() error {
+	if !w.started {
+		if w.code == 0 {
+			// nothing was written to the response
+			return nil
+		}
+		if err := w.start(true); err != nil {
+			return err
+		}
+	}
+	if w.enc != nil {
+		return w.enc.Close()
+	}
+	return nil
+}
+
+// Flush starts the response if it was buffered, and sends the compressed
+// data to the client.
+func (w *compressWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError starts the response if it was buffered, and sends the
+// compressed data to the client, if supported by the underlying writer.
+func (w *compressWriter) FlushError() error {
+	if !w.started {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		if err := w.start(false); err != nil {
+			return err
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack lets the handler take over the connection, for example to upgrade
+// it to a WebSocket, if supported by the underlying writer.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.started = true
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// bodyAllowed reports whether a response with the status code has a body.
+func bodyAllowed(code int) bool {
+	return code >= 200 && code != http.StatusNoContent && code != http.StatusNotModified
+}
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCompress tests that responses are compressed with the encoding
+// negotiated with the Accept-Encoding header.
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("the quick brown fox jumps over the lazy dog ", 100)
+
+	mux := NewRouter()
+	mux.Use(&Compress{ExcludeTypes: []string{"text/event-stream"}})
+	mux.Get("/json", func(w http.ResponseWriter, r *http.Request) {
+		ServeJson(w, map[string]string{"text": large})
+	})
+	mux.Get("/small", func(w http.ResponseWriter, r *http.Request) {
+		ServeJson(w, map[string]string{"text": "hello"})
+	})
+	mux.Get("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, large)
+	})
+	mux.Get("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, large)
+	})
+	mux.Get("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, large)
+	})
+
+	tests := []struct {
+		path     string
+		accept   string
+		code     int
+		encoding string
+		length   bool
+	}{
+		{"/json", "gzip, deflate", http.StatusOK, "gzip", false},
+		{"/json", "gzip;q=0.5, deflate", http.StatusOK, "deflate", false},
+		{"/json", "*", http.StatusOK, "gzip", false},
+		{"/json", "gzip;q=0, *", http.StatusOK, "deflate", false},
+		{"/json", "br", http.StatusOK, "", true},
+		{"/json", "", http.StatusOK, "", true},
+		{"/small", "gzip", http.StatusOK, "", true},
+		{"/text", "gzip", http.StatusCreated, "gzip", false},
+		{"/image", "gzip", http.StatusOK, "", false},
+		{"/events", "gzip", http.StatusOK, "", false},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept-Encoding", test.accept)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		name := test.path + " " + test.accept
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", name, w.Code, test.code)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("%s Content-Encoding set to [%s]; want [%s]", name, got, test.encoding)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s Vary set to [%s]; want [Accept-Encoding]", name, got)
+		}
+		if got := w.Header().Get("Content-Length") != ""; got != test.length {
+			t.Errorf("%s Content-Length set [%v]; want [%v]", name, got, test.length)
+		}
+
+		var body io.Reader = w.Body
+		switch test.encoding {
+		case "gzip":
+			body, _ = gzip.NewReader(w.Body)
+		case "deflate":
+			body, _ = zlib.NewReader(w.Body)
+		}
+		content, err := io.ReadAll(body)
+		if err != nil {
+			t.Errorf("%s body cannot be decoded: %v", name, err)
+		}
+		if !strings.Contains(string(content), "the quick brown fox") && test.path != "/small" {
+			t.Errorf("%s body set to [%.40s]; want the uncompressed content", name, content)
+		}
+	}
+}
+
+// TestCompressFlush tests that flushing a response streams the compressed
+// data, regardless of its size.
+func TestCompressFlush(t *testing.T) {
+	mux := NewRouter()
+	mux.Use(&Compress{})
+	mux.Get("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "first")
+		w.(http.Flusher).Flush()
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("Content-Encoding set to [%s] after Flush; want [gzip]", got)
+		}
+		io.WriteString(w, " second")
+	})
+
+	r, _ := http.NewRequest("GET", "/stream", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if !w.Flushed {
+		t.Errorf("Response not flushed")
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Body is not gzip encoded: %v", err)
+	}
+	content, _ := io.ReadAll(gz)
+	if string(content) != "first second" {
+		t.Errorf("Body set to [%s]; want [first second]", content)
+	}
+}
@@ -0,0 +1,276 @@
+package routes
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/drone/routes/internal/header"
+)
+
+// Key used to store the decoding options of the Router in the Context
+const decodingKey = "_decoding"
+
+// DecodeOptions configure how Read, Bind, ReadJson and ReadXml decode the
+// request body. The zero value decodes as ReadJson and ReadXml always did:
+// the size of the body is not limited, and its Content-Type is only used to
+// select the Codec of Read and Bind.
+type DecodeOptions struct {
+	// MaxBytes is the maximum size of the request body. If zero or
+	// negative, the size is not limited.
+	MaxBytes int64
+
+	// DisallowUnknownFields rejects JSON objects with fields that do not
+	// match the destination struct.
+	DisallowUnknownFields bool
+
+	// AllowTrailingData accepts JSON bodies with data after the decoded
+	// value. By default they are rejected, as by json.Unmarshal. XML bodies
+	// are always decoded up to the end of the root element, as by
+	// xml.Unmarshal, and the data after it is ignored.
+	AllowTrailingData bool
+
+	// RequireContentType rejects requests without a Content-Type header,
+	// whose body is decoded as JSON by default, and the requests read by
+	// ReadJson and ReadXml whose Content-Type is not JSON or XML.
+	RequireContentType bool
+}
+
+// Decoding sets the options used to decode request bodies.
+func (r *Router) Decoding(opts DecodeOptions) {
+	r.Lock()
+	r.decoding = opts
+	r.Unlock()
+}
+
+// decodingOf returns the decoding options of the Router serving the request.
+func decodingOf(r *http.Request) DecodeOptions {
+	opts, _ := NewContext(r).Values.Get(decodingKey).(DecodeOptions)
+	return opts
+}
+
+// StrictDecoder is implemented by Codecs that support the DecodeOptions
+// that control unknown fields and trailing data.
+type StrictDecoder interface {
+	DecodeStrict(r io.Reader, v interface{}, opts DecodeOptions) error
+}
+
+// Errors ----------------------------------------------------------------------
+
+// ErrUnsupportedMediaType is matched by the MediaTypeError returned when the
+// Content-Type of the request is not supported.
+var ErrUnsupportedMediaType = errors.New("routes: unsupported media type")
+
+// ErrTrailingData is the error of the DecodeError returned when the body has
+// data after the decoded value.
+var ErrTrailingData = errors.New("unexpected data after the decoded value")
+
+// MediaTypeError is returned when the Content-Type of the request is
+// missing or not supported.
+type MediaTypeError struct {
+	MediaType string // the media type of the request, if any
+}
+
+func (e *MediaTypeError) Error() string {
+	if e.MediaType == "" {
+		return "routes: missing Content-Type"
+	}
+	return "routes: unsupported media type " + strconv.Quote(e.MediaType)
+}
+
+// Is reports whether the target is ErrUnsupportedMediaType.
+func (e *MediaTypeError) Is(target error) bool {
+	return target == ErrUnsupportedMediaType
+}
+
+// StatusCode returns 415 Unsupported Media Type.
+func (e *MediaTypeError) StatusCode() int {
+	return http.StatusUnsupportedMediaType
+}
+
+// BodyTooLargeError is returned when the request body exceeds MaxBytes.
+type BodyTooLargeError struct {
+	Limit int64 // the maximum size of the body, in bytes
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("routes: request body exceeds %d bytes", e.Limit)
+}
+
+// StatusCode returns 413 Request Entity Too Large.
+func (e *BodyTooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// DecodeError is returned when the request body is malformed, or does not
+// match the destination value.
+type DecodeError struct {
+	Field  string // the path of the field that failed, if known
+	Offset int64  // the offset in the body where the error occurred
+	Err    error  // the underlying error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("routes: invalid request body: field %q at offset %d: %v", e.Field, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("routes: invalid request body at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns 400 Bad Request.
+func (e *DecodeError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Decoding --------------------------------------------------------------------
+
+// checkContentType checks the Content-Type of the request with the match
+// function, and returns its media type.
+func checkContentType(r *http.Request, opts DecodeOptions, match func(mediaType string) bool) (string, error) {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		if opts.RequireContentType {
+			return "", &MediaTypeError{}
+		}
+		return "", nil
+	}
+	mediaType, _ := header.ParseMediaType(ct)
+	if !match(mediaType) {
+		return mediaType, &MediaTypeError{MediaType: mediaType}
+	}
+	return mediaType, nil
+}
+
+// noBody reports whether the request has no body, such as a GET request.
+func noBody(r *http.Request) bool {
+	return r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0
+}
+
+// isJson reports whether the media type is JSON, including the structured
+// syntax suffix +json.
+func isJson(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// isXml reports whether the media type is XML, including the structured
+// syntax suffix +xml.
+func isXml(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// decode decodes the request body with the Codec, limiting the size of the
+// body to MaxBytes, if set.
+func decode(r *http.Request, c Codec, v interface{}, opts DecodeOptions) error {
+	defer r.Body.Close()
+
+	limit := opts.MaxBytes
+	if limit <= 0 {
+		return decodeWith(c, r.Body, v, opts)
+	}
+	if r.ContentLength > limit {
+		return &BodyTooLargeError{Limit: limit}
+	}
+
+	body := &limitedReader{r: r.Body, n: limit}
+	err := decodeWith(c, body, v, opts)
+	if body.exceeded {
+		return &BodyTooLargeError{Limit: limit}
+	}
+	return err
+}
+
+func decodeWith(c Codec, r io.Reader, v interface{}, opts DecodeOptions) error {
+	if s, ok := c.(StrictDecoder); ok {
+		return s.DecodeStrict(r, v, opts)
+	}
+	return c.Decode(r, v)
+}
+
+// limitedReader reads at most n bytes, and records whether the underlying
+// reader has more data.
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, &BodyTooLargeError{}
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		l.exceeded = true
+		return int(l.n), &BodyTooLargeError{}
+	}
+	l.n -= int64(n)
+	return n, err
+}
+
+// DecodeStrict decodes JSON with the DecodeOptions, and returns a
+// DecodeError describing malformed bodies.
+func (JsonCodec) DecodeStrict(r io.Reader, v interface{}, opts DecodeOptions) error {
+	dec := json.NewDecoder(r)
+	if opts.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return jsonError(dec, err)
+	}
+	if !opts.AllowTrailingData {
+		offset := dec.InputOffset()
+		if _, err := dec.Token(); err != io.EOF {
+			return &DecodeError{Offset: offset, Err: ErrTrailingData}
+		}
+	}
+	return nil
+}
+
+// jsonError converts the JSON decoding errors to a DecodeError.
+func jsonError(dec *json.Decoder, err error) error {
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case err == io.EOF:
+		return err
+	case errors.As(err, &syntax):
+		return &DecodeError{Offset: syntax.Offset, Err: err}
+	case errors.As(err, &typ):
+		return &DecodeError{Field: typ.Field, Offset: typ.Offset, Err: err}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		return &DecodeError{Field: field, Offset: dec.InputOffset(), Err: err}
+	}
+	var tooLarge *BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return &DecodeError{Offset: dec.InputOffset(), Err: err}
+}
+
+// DecodeStrict decodes XML with the DecodeOptions, and returns a
+// DecodeError describing malformed bodies. Unknown elements and attributes,
+// and the data after the root element, are always ignored.
+func (XmlCodec) DecodeStrict(r io.Reader, v interface{}, opts DecodeOptions) error {
+	dec := xml.NewDecoder(r)
+	if err := dec.Decode(v); err != nil {
+		var tooLarge *BodyTooLargeError
+		if err == io.EOF || errors.As(err, &tooLarge) {
+			return err
+		}
+		return &DecodeError{Offset: dec.InputOffset(), Err: err}
+	}
+	return nil
+}
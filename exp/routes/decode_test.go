@@ -0,0 +1,163 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// decodeRequest serves a POST request with the body and Content-Type, and
+// returns the error of the read function.
+func decodeRequest(opts DecodeOptions, read func(r *http.Request, v interface{}) error, body, contentType string, v interface{}) error {
+	var err error
+	mux := NewRouter()
+	mux.Decoding(opts)
+	mux.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		err = read(r, v)
+	})
+
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), r)
+	return err
+}
+
+type decodePerson struct {
+	Name    string `json:"name" xml:"name"`
+	Age     int    `json:"age" xml:"age"`
+	Address struct {
+		City string `json:"city"`
+	} `json:"address"`
+}
+
+// TestDecodeMaxBytes tests that bodies larger than MaxBytes are rejected
+// with a 413 error, whether or not the Content-Length is known, and are not
+// limited by default.
+func TestDecodeMaxBytes(t *testing.T) {
+	body := `{"name":"Morpheus","age":42}`
+	var person decodePerson
+
+	err := decodeRequest(DecodeOptions{MaxBytes: 16}, Read, body, "application/json", &person)
+	var tooLarge *BodyTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 16 || tooLarge.StatusCode() != http.StatusRequestEntityTooLarge {
+		t.Errorf("Read returned [%v]; want a 413 BodyTooLargeError", err)
+	}
+
+	mux := NewRouter()
+	mux.Decoding(DecodeOptions{MaxBytes: 16})
+	mux.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		err = ReadJson(r, &person)
+	})
+	r, _ := http.NewRequest("POST", "/", io.MultiReader(strings.NewReader(body)))
+	mux.ServeHTTP(httptest.NewRecorder(), r)
+	if !errors.As(err, &tooLarge) {
+		t.Errorf("ReadJson returned [%v]; want a BodyTooLargeError", err)
+	}
+
+	if err := decodeRequest(DecodeOptions{MaxBytes: int64(len(body))}, Read, body, "", &person); err != nil {
+		t.Errorf("Read returned [%v]; want nil", err)
+	}
+
+	// the size is not limited by default
+	large := `{"name":"` + strings.Repeat("M", 11<<20) + `"}`
+	if err := decodeRequest(DecodeOptions{}, ReadJson, large, "", &person); err != nil {
+		t.Errorf("ReadJson returned [%v]; want nil", err)
+	}
+}
+
+// TestDecodeErrors tests that malformed bodies return a DecodeError with
+// the field or offset that failed.
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		opts        DecodeOptions
+		body        string
+		contentType string
+		field       string
+		offset      int64
+		err         error
+	}{
+		{DecodeOptions{DisallowUnknownFields: true}, `{"name":"Morpheus","ship":"Nebuchadnezzar"}`, "application/json", "ship", -1, nil},
+		{DecodeOptions{}, `{"name":"Morpheus","age":"old"}`, "application/json", "age", -1, nil},
+		{DecodeOptions{}, `{"address":{"city":1}}`, "application/json", "address.city", -1, nil},
+		{DecodeOptions{}, `{"name":"Morpheus",}`, "application/json", "", 20, nil},
+		{DecodeOptions{}, `{"name":"Morpheus"} {"name":"Trinity"}`, "application/json", "", 19, ErrTrailingData},
+		{DecodeOptions{}, `{"name":"Morpheus"}garbage`, "application/json", "", 19, ErrTrailingData},
+	}
+
+	for _, test := range tests {
+		var person decodePerson
+		err := decodeRequest(test.opts, Read, test.body, test.contentType, &person)
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("Read [%s] returned [%v]; want a DecodeError", test.body, err)
+			continue
+		}
+		if decodeErr.Field != test.field {
+			t.Errorf("Read [%s] field set to [%s]; want [%s]", test.body, decodeErr.Field, test.field)
+		}
+		if test.offset >= 0 && decodeErr.Offset != test.offset {
+			t.Errorf("Read [%s] offset set to [%d]; want [%d]", test.body, decodeErr.Offset, test.offset)
+		}
+		if test.err != nil && !errors.Is(err, test.err) {
+			t.Errorf("Read [%s] returned [%v]; want [%v]", test.body, err, test.err)
+		}
+		if decodeErr.StatusCode() != http.StatusBadRequest {
+			t.Errorf("StatusCode set to [%d]; want [%d]", decodeErr.StatusCode(), http.StatusBadRequest)
+		}
+	}
+
+	trailing := []struct {
+		opts        DecodeOptions
+		body        string
+		contentType string
+	}{
+		{DecodeOptions{}, "{\"name\":\"Morpheus\"}\n", "application/json"},
+		{DecodeOptions{AllowTrailingData: true}, `{"name":"Morpheus"} trailing`, "application/json"},
+		{DecodeOptions{}, `<decodePerson><name>Morpheus</name></decodePerson>garbage`, "application/xml"},
+	}
+	for _, test := range trailing {
+		var person decodePerson
+		if err := decodeRequest(test.opts, Read, test.body, test.contentType, &person); err != nil {
+			t.Errorf("Read [%s] returned [%v]; want nil", test.body, err)
+		}
+	}
+}
+
+// TestDecodeContentType tests that a Content-Type that does not match the
+// decoder is rejected with a 415 error, by ReadJson only if required.
+func TestDecodeContentType(t *testing.T) {
+	tests := []struct {
+		opts        DecodeOptions
+		read        func(r *http.Request, v interface{}) error
+		contentType string
+		want        bool
+	}{
+		{DecodeOptions{}, ReadJson, "application/json; charset=utf-8", true},
+		{DecodeOptions{}, ReadJson, "application/problem+json", true},
+		{DecodeOptions{}, ReadJson, "", true},
+		{DecodeOptions{}, ReadJson, "text/plain", true},
+		{DecodeOptions{RequireContentType: true}, ReadJson, "application/json", true},
+		{DecodeOptions{RequireContentType: true}, ReadJson, "application/xml", false},
+		{DecodeOptions{RequireContentType: true}, ReadJson, "text/plain", false},
+		{DecodeOptions{RequireContentType: true}, ReadJson, "", false},
+		{DecodeOptions{RequireContentType: true}, Read, "", false},
+		{DecodeOptions{}, Read, "text/csv", false},
+	}
+
+	for _, test := range tests {
+		var person decodePerson
+		err := decodeRequest(test.opts, test.read, `{"name":"Morpheus"}`, test.contentType, &person)
+		if test.want && err != nil {
+			t.Errorf("Content-Type [%s] returned [%v]; want nil", test.contentType, err)
+		}
+		var mediaErr *MediaTypeError
+		if !test.want && (!errors.As(err, &mediaErr) || mediaErr.StatusCode() != http.StatusUnsupportedMediaType) {
+			t.Errorf("Content-Type [%s] returned [%v]; want a 415 MediaTypeError", test.contentType, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+)
+
+// EndpointFunc is a typed handler that receives the input bound from the
+// request, and returns the output written to the response.
+type EndpointFunc[In, Out any] func(ctx context.Context, in In) (Out, error)
+
+// Endpoint registers a typed handler for the method and pattern:
+//
+//	type CreateUser struct {
+//		Org   string `path:"org"`
+//		Name  string `json:"name" validate:"required"`
+//		Email string `json:"email" validate:"required,email"`
+//	}
+//
+//	routes.Endpoint(r, routes.POST, "/orgs/:org/users", func(ctx context.Context, in CreateUser) (*User, error) {
+//		return db.CreateUser(ctx, in.Org, in.Name, in.Email)
+//	})
+//
+// See EndpointHandler for how the request and response are handled.
+func Endpoint[In, Out any](r *Router, method, pattern string, fn EndpointFunc[In, Out]) *Route {
+	return r.AddRoute(method, pattern, EndpointHandler(fn))
+}
+
+// EndpointHandler adapts a typed handler to an http.HandlerFunc. The input
+// is bound from the path parameters, query string, headers and body with
+// Bind, and validated with Validate. The handler is called with the context
+// of the request, and its output is written with ServeFormatted.
+//
+// Errors, including the errors of Bind and Validate, are rendered as Handle
+// does, using the error mappings of the Router.
+func EndpointHandler[In, Out any](fn EndpointFunc[In, Out]) http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		var in In
+		if err := Bind(r, &in); err != nil {
+			return err
+		}
+		if err := Validate(&in); err != nil {
+			return err
+		}
+		out, err := fn(r.Context(), in)
+		if err != nil {
+			return err
+		}
+		ServeFormatted(w, r, out)
+		return nil
+	})
+}
@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createUser struct {
+	Org   string `path:"org"`
+	Name  string `json:"name" validate:"required"`
+	Email string `json:"email" validate:"required,email"`
+}
+
+type user struct {
+	Org  string `json:"org"`
+	Name string `json:"name"`
+}
+
+type ctxKey struct{}
+
+// TestEndpoint tests that typed handlers are called with the input bound
+// from the request, and their output or error is written to the response.
+func TestEndpoint(t *testing.T) {
+	mux := NewRouter()
+	mux.MapError(errNoSpoon, http.StatusNotFound)
+	Endpoint(mux, POST, "/orgs/:org/users", func(ctx context.Context, in createUser) (*user, error) {
+		if ctx.Value(ctxKey{}) != "value" {
+			t.Errorf("Endpoint not called with the request context")
+		}
+		if in.Name == "nobody" {
+			return nil, errNoSpoon
+		}
+		return &user{Org: in.Org, Name: in.Name}, nil
+	})
+
+	tests := []struct {
+		body string
+		code int
+		want string
+	}{
+		{`{"name":"neo","email":"neo@matrix.io"}`, http.StatusOK, `"org": "zion"`},
+		{`{"name":"neo","email":"neo"}`, http.StatusUnprocessableEntity, `"rule": "email"`},
+		{`{"name":`, http.StatusBadRequest, "Bad Request"},
+		{`{"name":"nobody","email":"nobody@matrix.io"}`, http.StatusNotFound, "Not Found"},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", "/orgs/zion/users", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/json")
+		r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, "value"))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", test.body, w.Code, test.code)
+		}
+		if !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s body set to [%s]; want [%s]", test.body, w.Body.String(), test.want)
+		}
+	}
+}
+
+// TestEndpointGet tests that a GET endpoint is not rejected for its missing
+// Content-Type when one is required.
+func TestEndpointGet(t *testing.T) {
+	mux := NewRouter()
+	mux.Decoding(DecodeOptions{RequireContentType: true})
+	Endpoint(mux, GET, "/orgs/:org", func(ctx context.Context, in struct {
+		Org string `path:"org"`
+	}) (*user, error) {
+		return &user{Org: in.Org}, nil
+	})
+
+	r, _ := http.NewRequest("GET", "/orgs/zion", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"org": "zion"`) {
+		t.Errorf("GET set to [%v %s]; want [%v]", w.Code, w.Body.String(), http.StatusOK)
+	}
+}
@@ -0,0 +1,222 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone/routes/internal/header"
+)
+
+// Key used to store the ETag mode of the Router in the Context
+const etagsKey = "_etags"
+
+// ETagMode selects the ETags generated for the responses written by
+// ServeJson, ServeXml, ServeTemplate and ServeFormatted.
+type ETagMode int
+
+// ETag modes supported by the Router.
+const (
+	ETagNone   ETagMode = iota // no ETags are generated
+	ETagStrong                 // strong ETags, for byte-identical content
+	ETagWeak                   // weak ETags, for semantically equivalent content
+)
+
+// ETags enables the generation of ETags from the encoded content of the
+// responses written by ServeJson, ServeXml, ServeTemplate and
+// ServeFormatted. An ETag set by the handler, for example from the version
+// of a resource, is used instead:
+//
+//	w.Header().Set("ETag", routes.WeakETag(strconv.Itoa(user.Version)))
+//	routes.ServeJson(w, user)
+//
+// GET and HEAD requests with a matching If-None-Match header are answered
+// with 304 Not Modified, without a body. The preconditions of unsafe
+// requests, such as If-Match on a PUT, PATCH or DELETE request, are not
+// evaluated by the Router, since the response is written after the update:
+// the handler must call CheckPreconditions before changing the resource.
+func (r *Router) ETags(mode ETagMode) {
+	r.Lock()
+	r.etags = mode
+	r.Unlock()
+}
+
+// StrongETag returns a strong entity tag with the opaque version, which
+// must not contain double quotes.
+func StrongETag(version string) string {
+	return `"` + version + `"`
+}
+
+// WeakETag returns a weak entity tag with the opaque version, which must
+// not contain double quotes.
+func WeakETag(version string) string {
+	return `W/"` + version + `"`
+}
+
+// newETag returns an ETag computed from the content.
+func newETag(content []byte, mode ETagMode) string {
+	sum := sha256.Sum256(content)
+	version := hex.EncodeToString(sum[:16])
+	if mode == ETagWeak {
+		return WeakETag(version)
+	}
+	return StrongETag(version)
+}
+
+// CheckPreconditions evaluates the conditional headers of the request
+// against the current ETag and modification time of the resource, as
+// defined by RFC 9110. Either may be empty or zero if the resource does
+// not have one, and the wildcard of If-Match and If-None-Match matches the
+// resource regardless. It must only be called for a resource that exists.
+// It returns true if the request should proceed.
+//
+// Otherwise it writes 304 Not Modified for GET and HEAD requests whose
+// If-None-Match or If-Modified-Since header matches the resource, or 412
+// Precondition Failed, and returns false. This allows optimistic
+// concurrency control of updates:
+//
+//	if !routes.CheckPreconditions(w, r, routes.WeakETag(strconv.Itoa(user.Version)), user.Updated) {
+//		return
+//	}
+//
+// For GET and HEAD requests, the ETag and Last-Modified headers are set.
+//
+// Unsafe requests, such as PUT, PATCH and DELETE, are only protected by
+// their preconditions if the handler calls CheckPreconditions before
+// changing the resource. The Router only evaluates the preconditions of GET
+// and HEAD requests when the response is written.
+func CheckPreconditions(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	safe := r.Method == GET || r.Method == HEAD
+	if safe {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		if !modified.IsZero() {
+			w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		}
+	}
+
+	switch evaluate(r, etag, modified) {
+	case http.StatusNotModified:
+		notModified(w)
+		return false
+	case http.StatusPreconditionFailed:
+		Error(w, http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// evaluate evaluates the conditional headers of the request in the order
+// defined by RFC 9110, section 13.2.2. It returns 304 or 412 if a
+// precondition fails, or 0 if the request should proceed.
+func evaluate(r *http.Request, etag string, modified time.Time) int {
+	safe := r.Method == GET || r.Method == HEAD
+
+	if values := r.Header.Values("If-Match"); len(values) != 0 {
+		if !matchETag(values, etag, strongMatch) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, ok := parseDate(r.Header.Get("If-Unmodified-Since")); ok && !modified.IsZero() {
+		if modified.Truncate(time.Second).After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if values := r.Header.Values("If-None-Match"); len(values) != 0 {
+		if matchETag(values, etag, weakMatch) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if since, ok := parseDate(r.Header.Get("If-Modified-Since")); ok && safe && !modified.IsZero() {
+		if !modified.Truncate(time.Second).After(since) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// matchETag reports whether the ETag matches one of the entity tags of the
+// If-Match or If-None-Match header values. The wildcard matches the current
+// representation of the resource, even if it has no ETag.
+func matchETag(values []string, etag string, match func(a, b string) bool) bool {
+	for _, value := range values {
+		for _, tag := range header.SplitQuoted(value, ',') {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || (etag != "" && match(tag, etag)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// strongMatch compares the entity tags with the strong comparison: both
+// must be strong, and identical.
+func strongMatch(a, b string) bool {
+	return a == b && !strings.HasPrefix(a, "W/")
+}
+
+// weakMatch compares the entity tags with the weak comparison: they must be
+// identical, ignoring the weak indicator.
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// parseDate parses an HTTP date.
+func parseDate(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(s)
+	return t, err == nil
+}
+
+// notModified writes a 304 Not Modified response, without the headers that
+// describe the body.
+func notModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// etagsOf returns the ETag mode of the Router serving the request.
+func etagsOf(r *http.Request) ETagMode {
+	mode, _ := NewContext(r).Values.Get(etagsKey).(ETagMode)
+	return mode
+}
+
+// writeContent writes the encoded content of a response with the status
+// code. Successful responses to GET and HEAD requests are given an ETag, if
+// enabled on the Router, and their conditional headers are evaluated.
+func writeContent(w http.ResponseWriter, code int, contentType string, content []byte) {
+	h := w.Header()
+	if rw := unwrap(w); code == http.StatusOK && rw != nil && rw.Router != nil && rw.req != nil {
+		if mode := etagsOf(rw.req); mode != ETagNone && h.Get("ETag") == "" {
+			h.Set("ETag", newETag(content, mode))
+		}
+		modified, _ := parseDate(h.Get("Last-Modified"))
+		if (rw.req.Method == GET || rw.req.Method == HEAD) && (h.Get("ETag") != "" || !modified.IsZero()) {
+			switch evaluate(rw.req, h.Get("ETag"), modified) {
+			case http.StatusNotModified:
+				notModified(w)
+				return
+			case http.StatusPreconditionFailed:
+				Error(w, http.StatusPreconditionFailed)
+				return
+			}
+		}
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(content)))
+	h.Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(content)
+}
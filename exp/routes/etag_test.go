@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestETags tests that ETags are generated from the content of responses,
+// and that GET requests with a matching If-None-Match are not modified.
+func TestETags(t *testing.T) {
+	type person struct{ Name string }
+
+	mux := NewRouter()
+	mux.ETags(ETagStrong)
+	mux.Get("/user", func(w http.ResponseWriter, r *http.Request) {
+		ServeJson(w, map[string]string{"name": "neo"})
+	})
+	mux.Get("/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", WeakETag("7"))
+		ServeXml(w, person{"neo"})
+	})
+
+	r, _ := http.NewRequest("GET", "/user", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	etag := w.Header().Get("ETag")
+	if len(etag) != 34 || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("ETag set to [%s]; want a strong ETag", etag)
+	}
+
+	tests := []struct {
+		path   string
+		match  string
+		code   int
+		etag   string
+		length string
+	}{
+		{"/user", etag, http.StatusNotModified, etag, ""},
+		{"/user", `"other", ` + etag, http.StatusNotModified, etag, ""},
+		{"/user", "W/" + etag, http.StatusNotModified, etag, ""},
+		{"/user", "*", http.StatusNotModified, etag, ""},
+		{"/user", `"other"`, http.StatusOK, etag, "19"},
+		{"/version", `"7"`, http.StatusNotModified, `W/"7"`, ""},
+		{"/version", `"8"`, http.StatusOK, `W/"7"`, "33"},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.Header.Set("If-None-Match", test.match)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s %s code set to [%v]; want [%v]", test.path, test.match, w.Code, test.code)
+		}
+		if got := w.Header().Get("ETag"); got != test.etag {
+			t.Errorf("%s %s ETag set to [%s]; want [%s]", test.path, test.match, got, test.etag)
+		}
+		if got := w.Header().Get("Content-Length"); got != test.length {
+			t.Errorf("%s %s Content-Length set to [%s]; want [%s]", test.path, test.match, got, test.length)
+		}
+		if test.code == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("%s %s body set to [%s]; want empty", test.path, test.match, w.Body.String())
+		}
+	}
+}
+
+// TestCheckPreconditions tests that the conditional headers are evaluated
+// in the order defined by RFC 9110.
+func TestCheckPreconditions(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		method  string
+		header  string
+		value   string
+		etag    string
+		code    int
+		proceed bool
+	}{
+		{"PUT", "If-Match", `"v1"`, `"v1"`, http.StatusOK, true},
+		{"PUT", "If-Match", `"v0", "v1"`, `"v1"`, http.StatusOK, true},
+		{"PUT", "If-Match", `"v0"`, `"v1"`, http.StatusPreconditionFailed, false},
+		{"PUT", "If-Match", `W/"v1"`, `W/"v1"`, http.StatusPreconditionFailed, false},
+		{"PUT", "If-Match", "*", `"v1"`, http.StatusOK, true},
+		{"PUT", "If-Match", "*", "", http.StatusOK, true},
+		{"PUT", "If-Match", `"v1"`, "", http.StatusPreconditionFailed, false},
+		{"PUT", "If-None-Match", "*", "", http.StatusPreconditionFailed, false},
+		{"DELETE", "If-Unmodified-Since", after, "", http.StatusOK, true},
+		{"DELETE", "If-Unmodified-Since", before, "", http.StatusPreconditionFailed, false},
+		{"PATCH", "If-None-Match", "*", `"v1"`, http.StatusPreconditionFailed, false},
+		{"GET", "If-None-Match", `W/"v1"`, `"v1"`, http.StatusNotModified, false},
+		{"GET", "If-Modified-Since", after, "", http.StatusNotModified, false},
+		{"GET", "If-Modified-Since", before, "", http.StatusOK, true},
+		{"GET", "If-Modified-Since", "yesterday", "", http.StatusOK, true},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, "/user", nil)
+		r.Header.Set(test.header, test.value)
+		w := httptest.NewRecorder()
+
+		proceed := CheckPreconditions(w, r, test.etag, modified)
+		if proceed != test.proceed {
+			t.Errorf("%s %s: %s returned [%v]; want [%v]", test.method, test.header, test.value, proceed, test.proceed)
+		}
+		if w.Code != test.code {
+			t.Errorf("%s %s: %s code set to [%v]; want [%v]", test.method, test.header, test.value, w.Code, test.code)
+		}
+	}
+}
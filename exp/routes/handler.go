@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HandlerErrorFunc is a hook that is invoked with the errors returned by the
+// handlers adapted with Handle, for example to report the errors.
+type HandlerErrorFunc func(r *http.Request, err error)
+
+// StatusCoder is implemented by errors that map to an HTTP status code, for
+// example a not found error that maps to 404 Not Found. The errors of this
+// package, such as DecodeError and ValidationError, implement StatusCoder.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// errorMapping maps the errors matching target to a status code.
+type errorMapping struct {
+	target error
+	code   int
+}
+
+// MapError maps the errors returned by handlers that match the target, as
+// reported by errors.Is, to the status code. For example:
+//
+//	r.MapError(sql.ErrNoRows, http.StatusNotFound)
+func (r *Router) MapError(target error, code int) {
+	r.Lock()
+	r.mappings = append(r.mappings, errorMapping{target, code})
+	r.Unlock()
+}
+
+// OnError adds a hook that is invoked with the errors returned by the
+// handlers adapted with Handle.
+func (r *Router) OnError(hook HandlerErrorFunc) {
+	r.Lock()
+	r.hooks = append(r.hooks, hook)
+	r.Unlock()
+}
+
+// Handle adapts a handler that returns an error to an http.HandlerFunc:
+//
+//	r.Get("/users/:id", routes.Handle(func(w http.ResponseWriter, r *http.Request) error {
+//		user, err := db.User(routes.NewContext(r).Params.Get("id"))
+//		if err != nil {
+//			return err
+//		}
+//		routes.ServeJson(w, user)
+//		return nil
+//	}))
+//
+// If the handler returns an error, and the response has not been written
+// to, the error is mapped to a status code and rendered with the ErrorFunc
+// of the Router. The status code is given by the first error registered
+// with MapError that matches the error, or by the StatusCode method of the
+// first error in its chain that implements StatusCoder. Other errors are
+// rendered as 500 Internal Server Error, and logged.
+//
+// A Problem is rendered with ServeProblem, and a ValidationError with
+// ServeInvalid.
+func Handle(handler func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := handler(w, r); err != nil {
+			handleError(w, r, err)
+		}
+	}
+}
+
+// handleError reports the error returned by a handler to the hooks, and
+// renders it if the response has not been written to.
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	var mappings []errorMapping
+	rw := unwrap(w)
+	if rw != nil && rw.Router != nil {
+		for _, hook := range rw.Router.hooks {
+			hook(r, err)
+		}
+		mappings = rw.Router.mappings
+	}
+
+	c := NewContext(r)
+	code := statusOf(mappings, err)
+	if code >= 500 {
+		c.Logger().Error("handler error", "error", err, "status", code)
+		c.Span().SetAttribute("error", err.Error())
+	}
+	if rw != nil && rw.started {
+		return
+	}
+
+	var problem *Problem
+	var invalid ValidationError
+	switch {
+	case errors.As(err, &problem):
+		ServeProblem(w, r, problem)
+	case errors.As(err, &invalid):
+		ServeInvalid(w, r, invalid)
+	default:
+		Error(w, code)
+	}
+}
+
+// statusOf returns the status code of the error, using the mappings, or the
+// StatusCoder interface. It returns 500 if the error is not mapped, or is
+// mapped to an invalid status code.
+func statusOf(mappings []errorMapping, err error) int {
+	for _, mapping := range mappings {
+		if errors.Is(err, mapping.target) {
+			return validStatus(mapping.code)
+		}
+	}
+	var coder StatusCoder
+	if errors.As(err, &coder) {
+		return validStatus(coder.StatusCode())
+	}
+	return http.StatusInternalServerError
+}
+
+// validStatus returns the status code if it is a valid final status, which
+// can be written without net/http panicking, or 500 otherwise.
+func validStatus(code int) int {
+	if code < 200 || code > 999 {
+		return http.StatusInternalServerError
+	}
+	return code
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// conflictError is a domain error that maps to 409 Conflict.
+type conflictError struct{ name string }
+
+func (e *conflictError) Error() string   { return e.name + " already exists" }
+func (e *conflictError) StatusCode() int { return http.StatusConflict }
+
+// statusError is an error that maps to its own, possibly invalid, code.
+type statusError int
+
+func (e statusError) Error() string   { return "status " + strconv.Itoa(int(e)) }
+func (e statusError) StatusCode() int { return int(e) }
+
+var errNoSpoon = errors.New("there is no spoon")
+
+// TestHandle tests that the errors returned by handlers are mapped to
+// status codes, and rendered with the ErrorFunc.
+func TestHandle(t *testing.T) {
+	var reported []error
+	mux := NewRouter()
+	mux.MapError(errNoSpoon, http.StatusNotFound)
+	mux.OnError(func(r *http.Request, err error) {
+		reported = append(reported, err)
+	})
+	mux.ErrorHandler(func(w http.ResponseWriter, r *http.Request, code int) {
+		http.Error(w, fmt.Sprintf("error %d", code), code)
+	})
+	mux.Get("/spoon", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("bending: %w", errNoSpoon)
+	}))
+	mux.Get("/user", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("creating user: %w", &conflictError{"neo"})
+	}))
+	mux.Post("/upload", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		var v struct{ Name string }
+		return Read(r, &v)
+	}))
+	mux.Get("/fail", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("connection refused")
+	}))
+	mux.Get("/invalid", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return statusError(0)
+	}))
+	mux.Get("/overflow", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return statusError(1000)
+	}))
+	mux.Get("/written", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		w.Write([]byte("partial"))
+		return errors.New("connection reset")
+	}))
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/spoon", http.StatusNotFound, "error 404\n"},
+		{"GET", "/user", http.StatusConflict, "error 409\n"},
+		{"POST", "/upload", http.StatusUnsupportedMediaType, "error 415\n"},
+		{"GET", "/fail", http.StatusInternalServerError, "error 500\n"},
+		{"GET", "/invalid", http.StatusInternalServerError, "error 500\n"},
+		{"GET", "/overflow", http.StatusInternalServerError, "error 500\n"},
+		{"GET", "/written", http.StatusOK, "partial"},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		r.Header.Set("Content-Type", "text/plain")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", test.path, w.Code, test.code)
+		}
+		if w.Body.String() != test.body {
+			t.Errorf("%s body set to [%s]; want [%s]", test.path, w.Body.String(), test.body)
+		}
+	}
+	if len(reported) != len(tests) {
+		t.Errorf("Reported [%d] errors; want [%d]", len(reported), len(tests))
+	}
+}
+
+// TestHandleProblem tests that a returned Problem or ValidationError is
+// rendered with its own format.
+func TestHandleProblem(t *testing.T) {
+	mux := NewRouter()
+	mux.Get("/problem", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("charging: %w", NewProblem(http.StatusPaymentRequired, "insufficient credit"))
+	}))
+	mux.Get("/invalid", Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return Validate(&validateItem{Quantity: 1})
+	}))
+
+	tests := []struct {
+		path        string
+		code        int
+		contentType string
+	}{
+		{"/problem", http.StatusPaymentRequired, "application/problem+json"},
+		{"/invalid", http.StatusUnprocessableEntity, "application/json"},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", test.path, w.Code, test.code)
+		}
+		if w.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%s Content-Type set to [%s]; want [%s]", test.path, w.Header().Get("Content-Type"), test.contentType)
+		}
+	}
+}
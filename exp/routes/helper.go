@@ -4,33 +4,38 @@ import (
 	"bytes"
 	"encoding/json"
 	"encoding/xml"
-	"io/ioutil"
 	"net/http"
-	"strconv"
+	"time"
 )
 
 // Helper Functions to Read from the http.Request Body -------------------------
 
 // ReadJson parses the JSON-encoded data in the http.Request object and
-// stores the result in the value pointed to by v.
+// stores the result in the value pointed to by v. The body is decoded with
+// the DecodeOptions of the Router, and if they require a Content-Type, a
+// MediaTypeError is returned if it is not JSON.
 func ReadJson(r *http.Request, v interface{}) error {
-	body, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		return err
+	opts := decodingOf(r)
+	if opts.RequireContentType {
+		if _, err := checkContentType(r, opts, isJson); err != nil {
+			return err
+		}
 	}
-	return json.Unmarshal(body, v)
+	return decode(r, JsonCodec{}, v, opts)
 }
 
 // ReadXml parses the XML-encoded data in the http.Request object and
-// stores the result in the value pointed to by v.
+// stores the result in the value pointed to by v. The body is decoded with
+// the DecodeOptions of the Router, and if they require a Content-Type, a
+// MediaTypeError is returned if it is not XML.
 func ReadXml(r *http.Request, v interface{}) error {
-	body, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		return err
+	opts := decodingOf(r)
+	if opts.RequireContentType {
+		if _, err := checkContentType(r, opts, isXml); err != nil {
+			return err
+		}
 	}
-	return xml.Unmarshal(body, v)
+	return decode(r, XmlCodec{}, v, opts)
 }
 
 // Helper Functions to Write to the http.ReponseWriter -------------------------
@@ -40,12 +45,10 @@ func ReadXml(r *http.Request, v interface{}) error {
 func ServeJson(w http.ResponseWriter, v interface{}) {
 	content, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serveError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(content)
+	writeContent(w, http.StatusOK, "application/json", content)
 }
 
 // ServeXml writes the XML representation of resource v to the
@@ -53,19 +56,24 @@ func ServeJson(w http.ResponseWriter, v interface{}) {
 func ServeXml(w http.ResponseWriter, v interface{}) {
 	content, err := xml.Marshal(v)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serveError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
-	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
-	w.Write(content)
+	writeContent(w, http.StatusOK, "text/xml; charset=utf-8", content)
 }
 
 // ServeTemplate applies the named template to the specified data map and
-// writes the output to the http.ResponseWriter.
+// writes the output to the http.ResponseWriter. The writer must be the one
+// passed to the handler by the Router, possibly wrapped by a middleware that
+// implements Unwrap, otherwise a 500 error is rendered.
 func ServeTemplate(w http.ResponseWriter, name string, data map[string]interface{}) {
-	// cast the writer to the resposneWriter, get the router
-	r := w.(*responseWriter).Router
+	// get the router from the writer, which may be wrapped by a middleware
+	rw := unwrap(w)
+	if rw == nil || rw.Router == nil {
+		Error(w, http.StatusInternalServerError)
+		return
+	}
+	r := rw.Router
 
 	r.RLock()
 	defer r.RUnlock()
@@ -80,17 +88,41 @@ func ServeTemplate(w http.ResponseWriter, name string, data map[string]interface
 	}
 
 	var buf bytes.Buffer
+	start := time.Now()
 	if err := r.views.ExecuteTemplate(&buf, name, data); err != nil {
 		panic(err)
-		return
+	}
+	if rw.timing != nil {
+		rw.timing.add("template", name, time.Since(start))
 	}
 
 	// set the content length, type, etc
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write(buf.Bytes())
+	writeContent(w, http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
 }
 
-// Error will terminate the http Request with the specified error code.
+// Error will terminate the http Request with the specified error code. The
+// error is rendered with the ErrorFunc of the Router, if any.
 func Error(w http.ResponseWriter, code int) {
-	http.Error(w, http.StatusText(code), code)
+	serveError(w, http.StatusText(code), code)
+}
+
+// serveError replies to the request with the specified error message and
+// code. If the Router has an ErrorFunc, it renders the error instead. If an
+// ID was assigned to the request, it is included in the message.
+func serveError(w http.ResponseWriter, msg string, code int) {
+	rw := unwrap(w)
+	if rw != nil && rw.Router != nil && rw.Router.errors != nil && !rw.failing {
+		// guard against an ErrorFunc that calls Error, or fails itself
+		rw.failing = true
+		defer func() { rw.failing = false }()
+		rw.Router.errors(w, rw.req, code)
+		return
+	}
+
+	if rw != nil && rw.req != nil {
+		if id := NewContext(rw.req).RequestID(); id != "" {
+			msg += " (request id " + id + ")"
+		}
+	}
+	http.Error(w, msg, code)
 }
@@ -0,0 +1,157 @@
+package routes
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Keys used to store the access log attributes in the Context
+const (
+	loggerKey = "_logger"
+	noLogKey  = "_nolog"
+)
+
+// LogFormat is the format of the records written by the AccessLog.
+type LogFormat int
+
+// Log formats supported by the AccessLog.
+const (
+	LogStructured LogFormat = iota // structured slog attributes
+	LogCommon                      // NCSA Common Log Format
+	LogCombined                    // Combined Log Format
+)
+
+// AccessLog is a middleware that logs every request handled by the Router
+// using log/slog. It is added to the Router with the Use method:
+//
+//	r.Use(&routes.AccessLog{Logger: slog.Default()})
+//
+// The AccessLog also stores a request scoped *slog.Logger in the Context,
+// so that handlers log with the same attributes.
+type AccessLog struct {
+	// Logger receives the access log records. If nil, slog.Default() is
+	// used.
+	Logger *slog.Logger
+
+	// Format of the access log records, one of LogStructured, LogCommon
+	// or LogCombined.
+	Format LogFormat
+
+	// Sample is the fraction of requests that are logged, between 0 and 1.
+	// If zero, every request is logged. Requests that fail with a 5xx
+	// status code are always logged.
+	Sample float64
+}
+
+// Filter stores the request scoped *slog.Logger in the Context. The
+// RequestID filter must be added before the AccessLog to include the
+// request ID in the logger attributes, and the ProxyHeaders filter to
+// log the address of the client behind a proxy.
+func (l *AccessLog) Filter(w http.ResponseWriter, r *http.Request) {
+	c := NewContext(r)
+	c.Values.Set(loggerKey, l.logger().With(
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("route", patternOf(w)),
+		slog.String("remote_ip", c.ClientIP()),
+		slog.String("request_id", c.RequestID()),
+	))
+}
+
+// After writes the access log record once the request has been handled.
+func (l *AccessLog) After(w http.ResponseWriter, r *http.Request, status int) {
+	if v, ok := NewContext(r).Values.Get(noLogKey).(bool); ok && v {
+		return
+	}
+	if l.Sample > 0 && status < 500 && rand.Float64() >= l.Sample {
+		return
+	}
+
+	var size int64
+	var elapsed time.Duration
+	start := time.Now()
+	if info, ok := Response(w); ok {
+		size = info.BytesWritten()
+		start = info.Start()
+		elapsed = time.Since(start)
+	}
+
+	level := slog.LevelInfo
+	if status >= 500 {
+		level = slog.LevelError
+	}
+
+	switch l.Format {
+	case LogCommon, LogCombined:
+		l.logger().Log(r.Context(), level, l.line(r, status, size, start))
+	default:
+		l.logger().LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", patternOf(w)),
+			slog.Int("status", status),
+			slog.Int64("bytes", size),
+			slog.Duration("duration", elapsed),
+			slog.String("remote_ip", NewContext(r).ClientIP()),
+			slog.String("request_id", NewContext(r).RequestID()),
+		)
+	}
+}
+
+// line formats the request using the Common or Combined Log Format, with
+// the time the request was received.
+func (l *AccessLog) line(r *http.Request, status int, size int64, start time.Time) string {
+	user := "-"
+	if r.URL.User != nil && r.URL.User.Username() != "" {
+		user = r.URL.User.Username()
+	}
+	bytes := "-"
+	if size > 0 {
+		bytes = strconv.FormatInt(size, 10)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		NewContext(r).ClientIP(), user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, r.URL.RequestURI(), r.Proto, status, bytes)
+
+	if l.Format == LogCombined {
+		line += fmt.Sprintf(" %q %q", r.Referer(), r.UserAgent())
+	}
+	return line
+}
+
+func (l *AccessLog) logger() *slog.Logger {
+	if l.Logger == nil {
+		return slog.Default()
+	}
+	return l.Logger
+}
+
+// NoAccessLog is a route filter that excludes the route from the access log.
+// This is typically used for health checks:
+//
+//	r.Get("/healthz", healthz).With(routes.NoAccessLog)
+func NoAccessLog(w http.ResponseWriter, r *http.Request) {
+	NewContext(r).Values.Set(noLogKey, true)
+}
+
+// Logger returns the request scoped *slog.Logger stored in the Context by
+// the AccessLog. If the AccessLog is not used, slog.Default() is returned.
+func (c *Context) Logger() *slog.Logger {
+	if l, ok := c.Values.Get(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// patternOf returns the route pattern matched by the request.
+func patternOf(w http.ResponseWriter) string {
+	if info, ok := Response(w); ok {
+		return info.Pattern()
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAccessLog tests that the request is logged with the matched route
+// pattern and response status, and that the request scoped logger is
+// stored in the Context.
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	mux := NewRouter()
+	mux.Filter((&RequestID{Generate: func() string { return "r42" }}).Filter)
+	mux.Use(&AccessLog{Logger: logger})
+	mux.Get("/person/:last/:first", func(w http.ResponseWriter, r *http.Request) {
+		NewContext(r).Logger().Info("knock knock")
+		HandlerOk(w, r)
+	})
+	mux.Get("/healthz", HandlerOk).With(NoAccessLog)
+
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged [%d] lines; want [%d]", len(lines), 2)
+	}
+	if !strings.Contains(lines[0], `msg="knock knock"`) || !strings.Contains(lines[0], "request_id=r42") {
+		t.Errorf("handler log line set to [%s]; want request attributes", lines[0])
+	}
+	for _, attr := range []string{"route=/person/:last/:first", "status=200", "bytes=11", "remote_ip=10.0.0.1", "request_id=r42"} {
+		if !strings.Contains(lines[1], attr) {
+			t.Errorf("access log line [%s] missing [%s]", lines[1], attr)
+		}
+	}
+
+	// the health check route should not be logged
+	buf.Reset()
+	r, _ = http.NewRequest("GET", "/healthz", nil)
+	mux.ServeHTTP(httptest.NewRecorder(), r)
+
+	if buf.Len() != 0 {
+		t.Errorf("access log set to [%s]; want empty", buf.String())
+	}
+}
+
+// TestAccessLogCombined tests the Combined Log Format.
+func TestAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	mux := NewRouter()
+	mux.Use(&AccessLog{Logger: logger, Format: LogCombined})
+	mux.Get("/person/:last/:first", HandlerOk)
+
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas?learn=kungfu", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("User-Agent", "nebuchadnezzar")
+	mux.ServeHTTP(httptest.NewRecorder(), r)
+
+	want := `\"GET /person/anderson/thomas?learn=kungfu HTTP/1.1\" 200 11 \"\" \"nebuchadnezzar\"`
+	if !strings.Contains(buf.String(), want) || !strings.HasPrefix(buf.String(), "time=") {
+		t.Errorf("access log set to [%s]; want [%s]", buf.String(), want)
+	}
+}
+
+// TestAccessLogStart tests that the Common Log Format records the time the
+// request was received, rather than the time it completed.
+func TestAccessLogStart(t *testing.T) {
+	start := time.Date(1999, time.March, 31, 9, 0, 0, 0, time.UTC)
+	r, _ := http.NewRequest("GET", "/matrix", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+
+	line := (&AccessLog{Format: LogCommon}).line(r, http.StatusOK, 11, start)
+	want := `10.0.0.1 - - [31/Mar/1999:09:00:00 +0000] "GET /matrix HTTP/1.1" 200 11`
+	if line != want {
+		t.Errorf("access log line set to [%s]; want [%s]", line, want)
+	}
+}
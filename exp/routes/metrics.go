@@ -0,0 +1,215 @@
+package routes
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key used to flag requests counted as in-flight in the Context
+const inflightKey = "_inflight"
+
+// DefaultBuckets are the default latency histogram buckets, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics is a middleware that records request counters, latency histograms
+// and in-flight request gauges per route pattern and method. Labelling by the
+// route pattern, instead of the request path, keeps the number of series
+// bounded. It is added to the Router with the Use method, and the metrics
+// are exposed in the Prometheus text format by its ServeHTTP method:
+//
+//	metrics := &routes.Metrics{}
+//	r.Use(metrics)
+//	r.Get("/metrics", metrics.ServeHTTP)
+type Metrics struct {
+	// Namespace is an optional prefix for the metric names.
+	Namespace string
+
+	// Buckets are the upper bounds of the latency histogram buckets, in
+	// seconds, in increasing order. If nil, DefaultBuckets are used.
+	Buckets []float64
+
+	mu     sync.Mutex
+	series map[seriesKey]*series
+}
+
+// seriesKey identifies the metrics of a route and method.
+type seriesKey struct {
+	method string
+	route  string
+}
+
+// series stores the metrics of a route and method.
+type series struct {
+	codes    map[int]uint64 // request count by status code
+	buckets  []uint64       // request count by latency bucket
+	sum      float64        // sum of the request latencies, in seconds
+	count    uint64         // number of observed requests
+	inflight int64          // number of requests being handled
+}
+
+// Filter increments the in-flight gauge of the matched route.
+func (m *Metrics) Filter(w http.ResponseWriter, r *http.Request) {
+	NewContext(r).Values.Set(inflightKey, true)
+
+	m.mu.Lock()
+	m.get(r.Method, patternOf(w)).inflight++
+	m.mu.Unlock()
+}
+
+// After records the status code and latency of the request.
+func (m *Metrics) After(w http.ResponseWriter, r *http.Request, status int) {
+	var elapsed time.Duration
+	if info, ok := Response(w); ok {
+		elapsed = time.Since(info.Start())
+	}
+	seconds := elapsed.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.get(r.Method, patternOf(w))
+	if v, ok := NewContext(r).Values.Get(inflightKey).(bool); ok && v {
+		s.inflight--
+	}
+	s.codes[status]++
+	s.sum += seconds
+	s.count++
+	for i, bound := range m.buckets() {
+		if seconds <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]seriesKey, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	buf := bufio.NewWriter(w)
+	defer buf.Flush()
+
+	name := m.name("http_requests_total")
+	fmt.Fprintf(buf, "# HELP %s Total number of HTTP requests.\n", name)
+	fmt.Fprintf(buf, "# TYPE %s counter\n", name)
+	for _, key := range keys {
+		s := m.series[key]
+		codes := make([]int, 0, len(s.codes))
+		for code := range s.codes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(buf, "%s{%s,code=\"%d\"} %d\n", name, key.labels(), code, s.codes[code])
+		}
+	}
+
+	name = m.name("http_request_duration_seconds")
+	fmt.Fprintf(buf, "# HELP %s Latency of HTTP requests in seconds.\n", name)
+	fmt.Fprintf(buf, "# TYPE %s histogram\n", name)
+	for _, key := range keys {
+		s := m.series[key]
+		if s.count == 0 {
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range m.buckets() {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(buf, "%s_bucket{%s,le=\"%s\"} %d\n", name, key.labels(), formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, key.labels(), s.count)
+		fmt.Fprintf(buf, "%s_sum{%s} %s\n", name, key.labels(), formatFloat(s.sum))
+		fmt.Fprintf(buf, "%s_count{%s} %d\n", name, key.labels(), s.count)
+	}
+
+	name = m.name("http_requests_in_flight")
+	fmt.Fprintf(buf, "# HELP %s Number of HTTP requests being handled.\n", name)
+	fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+	for _, key := range keys {
+		fmt.Fprintf(buf, "%s{%s} %d\n", name, key.labels(), m.series[key].inflight)
+	}
+}
+
+// get returns the series for the route and method, creating it if it does
+// not exist. The caller must hold the lock.
+func (m *Metrics) get(method, route string) *series {
+	key := seriesKey{method: normalizeMethod(method), route: route}
+	if route == "" {
+		key.route = "unmatched"
+	}
+
+	if m.series == nil {
+		m.series = make(map[seriesKey]*series)
+	}
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{
+			codes:   make(map[int]uint64),
+			buckets: make([]uint64, len(m.buckets())),
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+func (m *Metrics) buckets() []float64 {
+	if m.Buckets == nil {
+		return DefaultBuckets
+	}
+	return m.Buckets
+}
+
+func (m *Metrics) name(name string) string {
+	if m.Namespace == "" {
+		return name
+	}
+	return m.Namespace + "_" + name
+}
+
+// labels formats the route and method labels of the series.
+func (k seriesKey) labels() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\"", escapeLabel(k.method), escapeLabel(k.route))
+}
+
+// normalizeMethod returns the request method, or OTHER for non-standard
+// methods, to keep the number of series bounded.
+func normalizeMethod(method string) string {
+	switch method {
+	case CONNECT, DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT, TRACE:
+		return method
+	}
+	return "OTHER"
+}
+
+// labelEscaper escapes label values for the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value for the Prometheus text format.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// formatFloat formats a sample value for the Prometheus text format.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
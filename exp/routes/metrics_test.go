@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMetrics tests that requests are counted by route pattern, and exposed
+// in the Prometheus text format.
+func TestMetrics(t *testing.T) {
+	metrics := &Metrics{Buckets: []float64{0.5, 1}}
+
+	mux := NewRouter()
+	mux.Use(metrics)
+	mux.Get("/person/:last/:first", HandlerOk)
+	mux.Get("/metrics", metrics.ServeHTTP)
+
+	for _, path := range []string{"/person/anderson/thomas", "/person/reeves/keanu", "/unknown"} {
+		r, _ := http.NewRequest("GET", path, nil)
+		mux.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	r, _ := http.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type set to [%s]; want [%s]", ct, "text/plain; version=0.0.4")
+	}
+
+	for _, line := range []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{method="GET",route="/person/:last/:first",code="200"} 2`,
+		`http_requests_total{method="GET",route="unmatched",code="404"} 1`,
+		"# TYPE http_request_duration_seconds histogram",
+		`http_request_duration_seconds_bucket{method="GET",route="/person/:last/:first",le="0.5"} 2`,
+		`http_request_duration_seconds_bucket{method="GET",route="/person/:last/:first",le="+Inf"} 2`,
+		`http_request_duration_seconds_count{method="GET",route="/person/:last/:first"} 2`,
+		"# TYPE http_requests_in_flight gauge",
+		`http_requests_in_flight{method="GET",route="/person/:last/:first"} 0`,
+		`http_requests_in_flight{method="GET",route="/metrics"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("metrics missing line [%s]", line)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/drone/routes/internal/header"
+)
+
+// NotAcceptable writes a 406 Not Acceptable error, with the list of media
+// types supported by the handler.
+func NotAcceptable(w http.ResponseWriter, offers ...string) {
+	msg := http.StatusText(http.StatusNotAcceptable) + ". Supported types: " + strings.Join(offers, ", ")
+	serveError(w, msg, http.StatusNotAcceptable)
+}
+
+// Negotiate returns the media type from the list of offers that best
+// matches the Accept header of the request, as defined by RFC 9110. The
+// offer with the highest quality value is returned, and ties are resolved
+// in the order of the offers. Each offer is weighted by the most specific
+// media range that matches it, so that "text/*;q=0.5, text/html" prefers
+// text/html over text/plain.
+//
+// If the request has no Accept header, or it is empty, the first offer is returned. If none
+// of the offers is acceptable an empty string is returned.
+func Negotiate(r *http.Request, offers ...string) string {
+	return header.Negotiate(r.Header.Values("Accept"), offers...)
+}
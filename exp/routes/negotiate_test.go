@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestNegotiate tests that the media type is negotiated with the Accept
+// header, using quality values, wildcards and parameters.
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/json", "application/xml", "text/xml"}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"application/json", "application/json"},
+		{"application/json; charset=utf-8", "application/json"},
+		{"Application/XML", "application/xml"},
+		{"text/xml", "text/xml"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "application/xml"},
+		{"*/*", "application/json"},
+		{"text/*", "text/xml"},
+		{"application/*;q=0.5, text/xml", "text/xml"},
+		{"*/*;q=0.1, application/json;q=0", "application/xml"},
+		{"application/json;q=0.5, application/xml;q=0.5", "application/json"},
+		{"text/xml;charset=\"utf-8\";q=0.3, application/xml;q=0.2", "text/xml"},
+		{"text/html", ""},
+		{"application/json;q=0", ""},
+		{"application/json;q=2, text/html", ""},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		if got := Negotiate(r, offers...); got != test.want {
+			t.Errorf("Negotiate [%s] set to [%s]; want [%s]", test.accept, got, test.want)
+		}
+	}
+}
+
+// TestServeFormatted tests that the resource is served in the negotiated
+// format, or a 406 error lists the supported types.
+func TestServeFormatted(t *testing.T) {
+	type person struct {
+		Name string
+	}
+	tests := []struct {
+		accept      string
+		code        int
+		contentType string
+	}{
+		{"application/json; charset=utf-8", http.StatusOK, "application/json"},
+		{"text/html,application/xml;q=0.9,*/*;q=0.8", http.StatusOK, "application/xml; charset=utf-8"},
+		{"text/xml", http.StatusOK, "text/xml; charset=utf-8"},
+		{"text/html", http.StatusNotAcceptable, "text/plain; charset=utf-8"},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		ServeFormatted(w, r, &person{Name: "Morpheus"})
+
+		if w.Code != test.code {
+			t.Errorf("Code set to [%v]; want [%v]", w.Code, test.code)
+		}
+		if w.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("Content-Type set to [%s]; want [%s]", w.Header().Get("Content-Type"), test.contentType)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Vary set to [%s]; want [%s]", w.Header().Get("Vary"), "Accept")
+		}
+		if test.code == http.StatusNotAcceptable && !strings.Contains(w.Body.String(), "application/json, application/xml, text/xml") {
+			t.Errorf("Body set to [%s]; want the supported types", w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Problem describes an error in an HTTP API, as defined by RFC 9457. It is
+// written to the response by ServeProblem as application/problem+json or
+// application/problem+xml.
+type Problem struct {
+	// Type is a URI reference that identifies the problem type. If empty,
+	// it is "about:blank", meaning the problem is described by the status
+	// code.
+	Type string
+
+	// Title is a short summary of the problem type.
+	Title string
+
+	// Status is the HTTP status code.
+	Status int
+
+	// Detail is an explanation specific to this occurrence of the problem.
+	Detail string
+
+	// Instance is a URI reference that identifies this occurrence of the
+	// problem.
+	Instance string
+
+	// Extensions are additional members of the problem, such as the list of
+	// invalid fields.
+	Extensions map[string]interface{}
+}
+
+// NewProblem returns a Problem with the status code, and its status text as
+// the title.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// Error returns the title and detail of the Problem, so that a Problem can
+// be returned as an error.
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// StatusCode returns the status code of the Problem, or 500 if it is not
+// set or not a valid status code.
+func (p *Problem) StatusCode() int {
+	return validStatus(p.Status)
+}
+
+// MarshalJSON encodes the Problem as a JSON object, with the extensions as
+// additional members.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for key, value := range p.Extensions {
+		m[key] = value
+	}
+	for key, value := range p.members() {
+		m[key] = value
+	}
+	return json.Marshal(m)
+}
+
+// MarshalXML encodes the Problem as the problem element of RFC 9457, with
+// the extensions as additional elements.
+func (p *Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Space: "urn:ietf:rfc:7807", Local: "problem"}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	members := p.members()
+	for _, key := range []string{"type", "title", "status", "detail", "instance"} {
+		if value, ok := members[key]; ok {
+			if err := e.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: key}}); err != nil {
+				return err
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(p.Extensions))
+	for key := range p.Extensions {
+		if _, ok := members[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := e.EncodeElement(p.Extensions[key], xml.StartElement{Name: xml.Name{Local: key}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// members returns the standard members of the Problem that are set.
+func (p *Problem) members() map[string]interface{} {
+	m := make(map[string]interface{}, 5)
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return m
+}
+
+// ServeProblem writes the Problem with its status code, as
+// application/problem+xml if the client prefers XML to JSON, and as
+// application/problem+json otherwise. If an ID was assigned to the request,
+// it is added to the problem as the request_id extension.
+func ServeProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if id := NewContext(r).RequestID(); id != "" {
+		if _, ok := p.Extensions["request_id"]; !ok {
+			ext := make(map[string]interface{}, len(p.Extensions)+1)
+			for key, value := range p.Extensions {
+				ext[key] = value
+			}
+			ext["request_id"] = id
+			copied := *p
+			copied.Extensions = ext
+			p = &copied
+		}
+	}
+
+	w.Header().Add("Vary", "Accept")
+	contentType := "application/problem+json"
+	var content []byte
+	var err error
+	switch Negotiate(r, "application/problem+json", "application/json", "application/problem+xml", "application/xml", "text/xml") {
+	case "application/problem+xml", "application/xml", "text/xml":
+		contentType = "application/problem+xml"
+		content, err = xml.Marshal(p)
+	default:
+		content, err = json.MarshalIndent(p, "", "  ")
+	}
+	if err != nil {
+		serveError(w, fmt.Sprintf("%s: %v", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.StatusCode())
+	w.Write(content)
+}
+
+// ProblemError is an ErrorFunc that renders the errors of the Router as
+// problem details, for example 404 Not Found or 405 Method Not Allowed:
+//
+//	r.ErrorHandler(routes.ProblemError)
+func ProblemError(w http.ResponseWriter, r *http.Request, code int) {
+	ServeProblem(w, r, NewProblem(code, ""))
+}
@@ -0,0 +1,157 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestServeProblem tests that a Problem is written as problem+json, with the
+// extensions as additional members.
+func TestServeProblem(t *testing.T) {
+	p := NewProblem(http.StatusConflict, "the username is taken")
+	p.Type = "https://example.com/probs/username-taken"
+	p.Extensions = map[string]interface{}{"username": "neo"}
+
+	r, _ := http.NewRequest("POST", "/users", nil)
+	w := httptest.NewRecorder()
+	ServeProblem(w, r, p)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusConflict)
+	}
+	if w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("Content-Type set to [%s]; want [%s]", w.Header().Get("Content-Type"), "application/problem+json")
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Body [%s] is not JSON: %v", w.Body.String(), err)
+	}
+	want := map[string]interface{}{
+		"type":     "https://example.com/probs/username-taken",
+		"title":    "Conflict",
+		"status":   float64(http.StatusConflict),
+		"detail":   "the username is taken",
+		"username": "neo",
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("Member [%s] set to [%v]; want [%v]", key, body[key], value)
+		}
+	}
+	if _, ok := body["instance"]; ok {
+		t.Errorf("Member [instance] is set; want it omitted")
+	}
+}
+
+// TestServeProblemXml tests that a Problem is written as problem+xml if the
+// client prefers XML.
+func TestServeProblemXml(t *testing.T) {
+	p := NewProblem(http.StatusNotFound, "")
+	p.Extensions = map[string]interface{}{"resource": "person"}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/xml, application/json;q=0.5")
+	w := httptest.NewRecorder()
+	ServeProblem(w, r, p)
+
+	want := `<problem xmlns="urn:ietf:rfc:7807"><title>Not Found</title><status>404</status><resource>person</resource></problem>`
+	if w.Body.String() != want {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), want)
+	}
+	if w.Header().Get("Content-Type") != "application/problem+xml" {
+		t.Errorf("Content-Type set to [%s]; want [%s]", w.Header().Get("Content-Type"), "application/problem+xml")
+	}
+}
+
+// TestProblemError tests that the errors generated by the Router, and by
+// the Error function, are rendered as problem details.
+func TestProblemError(t *testing.T) {
+	mux := NewRouter()
+	mux.ErrorHandler(ProblemError)
+	mux.Filter((&RequestID{Generate: func() string { return "42" }}).Filter)
+	mux.Get("/person/:name", HandlerOk)
+	mux.Post("/upload", func(w http.ResponseWriter, r *http.Request) {
+		Error(w, http.StatusRequestEntityTooLarge)
+	})
+	mux.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("there is no spoon")
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"GET", "/", http.StatusNotFound},
+		{"DELETE", "/person/neo", http.StatusMethodNotAllowed},
+		{"POST", "/upload", http.StatusRequestEntityTooLarge},
+		{"GET", "/panic", http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s %s code set to [%v]; want [%v]", test.method, test.path, w.Code, test.code)
+		}
+		if w.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("%s %s Content-Type set to [%s]; want [%s]", test.method, test.path, w.Header().Get("Content-Type"), "application/problem+json")
+		}
+		if test.code != http.StatusNotFound && test.code != http.StatusMethodNotAllowed && !strings.Contains(w.Body.String(), `"request_id": "42"`) {
+			t.Errorf("%s %s body set to [%s]; want the request id", test.method, test.path, w.Body.String())
+		}
+	}
+}
+
+// TestMethodNotAllowed tests that a 405 code is returned, with the allowed
+// methods, if the url only matches routes for other methods.
+func TestMethodNotAllowed(t *testing.T) {
+	mux := NewRouter()
+	mux.Get("/person/:name", HandlerOk)
+	mux.Put("/person/:name", HandlerOk)
+	mux.Get("/person/:name/friends", HandlerOk)
+
+	r, _ := http.NewRequest("POST", "/person/neo", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusMethodNotAllowed)
+	}
+	if w.Header().Get("Allow") != "GET, PUT, HEAD" {
+		t.Errorf("Allow set to [%s]; want [%s]", w.Header().Get("Allow"), "GET, PUT, HEAD")
+	}
+}
+
+// TestHead tests that HEAD requests are served by the GET routes, unless a
+// HEAD route matches the url.
+func TestHead(t *testing.T) {
+	mux := NewRouter()
+	mux.Get("/person/:name", HandlerOk)
+	mux.Get("/status", HandlerOk)
+	mux.AddRoute("HEAD", "/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Status", "up")
+	})
+
+	r, _ := http.NewRequest("HEAD", "/person/neo", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusOK)
+	}
+
+	r, _ = http.NewRequest("HEAD", "/status", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Header().Get("X-Status") != "up" {
+		t.Errorf("X-Status set to [%s]; want [%s]", w.Header().Get("X-Status"), "up")
+	}
+}
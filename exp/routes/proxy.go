@@ -0,0 +1,233 @@
+package routes
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/drone/routes/internal/header"
+)
+
+// Key used to store the resolved client in the Context
+const clientKey = "_client"
+
+// client stores the client IP address, scheme and host of the request.
+type client struct {
+	ip     string
+	scheme string
+	host   string
+}
+
+// ProxyHeaders is a middleware filter that resolves the client IP address,
+// scheme and host of requests forwarded by trusted proxies, using the
+// Forwarded (RFC 7239) or X-Forwarded-For, X-Forwarded-Proto and
+// X-Forwarded-Host headers. It is added to the Router with the Filter
+// method:
+//
+//	proxies := &routes.ProxyHeaders{
+//		Trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+//	}
+//	r.Filter(proxies.Filter)
+//
+// The forwarding headers are only considered when the request is received
+// from a trusted proxy. The hops are walked from the right, and the client
+// is the first hop that is not a trusted proxy.
+type ProxyHeaders struct {
+	// Trusted is the list of trusted proxy networks.
+	Trusted []netip.Prefix
+}
+
+// Filter resolves the client of the request and stores it in the Context.
+func (p *ProxyHeaders) Filter(w http.ResponseWriter, r *http.Request) {
+	c := directClient(r)
+
+	if p.trusted(c.ip) {
+		if values := r.Header.Values("Forwarded"); len(values) > 0 {
+			p.resolve(&c, parseForwarded(values))
+		} else if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			p.resolve(&c, parseXForwarded(r, values))
+		}
+	}
+
+	NewContext(r).Values.Set(clientKey, c)
+}
+
+// resolve walks the hops from the right, and updates the client with the
+// first hop that is not a trusted proxy.
+func (p *ProxyHeaders) resolve(c *client, hops []forwardedHop) {
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := parseNode(hops[i].node)
+		if !ok {
+			return
+		}
+		c.ip = ip
+		if hops[i].proto != "" {
+			c.scheme = strings.ToLower(hops[i].proto)
+		}
+		if hops[i].host != "" {
+			c.host = hops[i].host
+		}
+		if !p.trusted(ip) {
+			return
+		}
+	}
+}
+
+// trusted reports whether the IP address belongs to a trusted proxy.
+func (p *ProxyHeaders) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.Trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client, as resolved by the
+// ProxyHeaders filter. If the filter is not used, the address of the
+// remote end of the connection is returned.
+func (c *Context) ClientIP() string {
+	return c.client().ip
+}
+
+// Scheme returns the URL scheme requested by the client, either http or
+// https, as resolved by the ProxyHeaders filter.
+func (c *Context) Scheme() string {
+	return c.client().scheme
+}
+
+// Host returns the host requested by the client, as resolved by the
+// ProxyHeaders filter.
+func (c *Context) Host() string {
+	return c.client().host
+}
+
+func (c *Context) client() client {
+	if v, ok := c.Values.Get(clientKey).(client); ok {
+		return v
+	}
+	return directClient(c.req)
+}
+
+// directClient returns the client of the request, ignoring any forwarding
+// headers.
+func directClient(r *http.Request) client {
+	c := client{ip: remoteIP(r), scheme: "http", host: r.Host}
+	if r.TLS != nil {
+		c.scheme = "https"
+	}
+	return c
+}
+
+// remoteIP returns the IP address of the remote end of the connection.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Forwarding Header Parsing ---------------------------------------------------
+
+// forwardedHop is a single hop in the forwarding headers.
+type forwardedHop struct {
+	node  string // the address of the client that connected to the proxy
+	proto string // the protocol used by the client
+	host  string // the Host requested by the client
+}
+
+// parseForwarded parses the elements of the Forwarded header, as defined by
+// RFC 7239. For example:
+//
+//	Forwarded: for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8::1]"
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, element := range header.SplitQuoted(value, ',') {
+			var hop forwardedHop
+			for _, pair := range header.SplitQuoted(element, ';') {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				val = header.Unquote(strings.TrimSpace(val))
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "for":
+					hop.node = val
+				case "proto":
+					hop.proto = val
+				case "host":
+					hop.host = val
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseXForwarded parses the X-Forwarded-For header, and the corresponding
+// X-Forwarded-Proto and X-Forwarded-Host headers.
+func parseXForwarded(r *http.Request, values []string) []forwardedHop {
+	nodes := splitList(values)
+	protos := splitList(r.Header.Values("X-Forwarded-Proto"))
+	hosts := splitList(r.Header.Values("X-Forwarded-Host"))
+
+	hops := make([]forwardedHop, len(nodes))
+	for i, node := range nodes {
+		hops[i].node = node
+	}
+	assign(hops, protos, func(h *forwardedHop, v string) { h.proto = v })
+	assign(hops, hosts, func(h *forwardedHop, v string) { h.host = v })
+	return hops
+}
+
+// assign applies the values of a forwarding header to the hops. If there is
+// one value per hop, each value is applied to the matching hop, otherwise
+// the rightmost value is applied to the rightmost hop.
+func assign(hops []forwardedHop, values []string, set func(*forwardedHop, string)) {
+	switch {
+	case len(hops) == 0 || len(values) == 0:
+	case len(hops) == len(values):
+		for i := range hops {
+			set(&hops[i], values[i])
+		}
+	default:
+		set(&hops[len(hops)-1], values[len(values)-1])
+	}
+}
+
+// parseNode parses the IP address of a forwarded node, which may include a
+// port, and IPv6 addresses enclosed in brackets. Obfuscated and unknown
+// identifiers are rejected.
+func parseNode(node string) (string, bool) {
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	node = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	addr, err := netip.ParseAddr(node)
+	if err != nil {
+		return "", false
+	}
+	return addr.Unmap().String(), true
+}
+
+// splitList splits the comma separated values of a header.
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// TestProxyHeaders tests that the client IP address, scheme and host are
+// resolved from the forwarding headers of trusted proxies only.
+func TestProxyHeaders(t *testing.T) {
+	proxies := &ProxyHeaders{
+		Trusted: []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("2001:db8:ffff::/48"),
+		},
+	}
+
+	tests := []struct {
+		remote string
+		header map[string]string
+		ip     string
+		scheme string
+		host   string
+	}{
+		// untrusted remote, headers are ignored
+		{"203.0.113.9:1234", map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https"}, "203.0.113.9", "http", "example.com"},
+		// trusted remote, without forwarding headers
+		{"10.0.0.1:1234", nil, "10.0.0.1", "http", "example.com"},
+		// trusted remote, single hop
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.9", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "matrix.io"}, "203.0.113.9", "https", "matrix.io"},
+		// spoofed hops to the left of the first untrusted hop are ignored
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.9.9.9, 198.51.100.7, 10.0.0.2"}, "198.51.100.7", "http", "example.com"},
+		// every hop is trusted, the leftmost hop is the client
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3", "http", "example.com"},
+		// invalid hops stop the walk
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7, garbage, 10.0.0.2"}, "10.0.0.2", "http", "example.com"},
+		// RFC 7239 Forwarded header takes precedence
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `for=198.51.100.7;proto=https;host="matrix.io", for="10.0.0.2:8080"`, "X-Forwarded-For": "1.2.3.4"}, "198.51.100.7", "https", "matrix.io"},
+		// RFC 7239 with IPv6 addresses
+		{"[2001:db8:ffff::1]:1234", map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711";proto=HTTPS`}, "2001:db8:cafe::17", "https", "example.com"},
+		// RFC 7239 obfuscated identifiers stop the walk
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `for=_hidden, for=10.0.0.2`}, "10.0.0.2", "http", "example.com"},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "http://example.com/", nil)
+		r.RemoteAddr = test.remote
+		for key, value := range test.header {
+			r.Header.Set(key, value)
+		}
+
+		mux := NewRouter()
+		mux.Filter(proxies.Filter)
+		mux.Get("/", HandlerOk)
+		mux.ServeHTTP(httptest.NewRecorder(), r)
+
+		c := NewContext(r)
+		if c.ClientIP() != test.ip {
+			t.Errorf("client ip for %v set to [%s]; want [%s]", test.header, c.ClientIP(), test.ip)
+		}
+		if c.Scheme() != test.scheme {
+			t.Errorf("scheme for %v set to [%s]; want [%s]", test.header, c.Scheme(), test.scheme)
+		}
+		if c.Host() != test.host {
+			t.Errorf("host for %v set to [%s]; want [%s]", test.header, c.Host(), test.host)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Key used to store the request ID in the Context
+const requestIDKey = "_request_id"
+
+// RequestID is a middleware filter that assigns an ID to every request, so
+// that logs can be correlated across services. It is added to the Router
+// with the Filter method:
+//
+//	r.Filter((&routes.RequestID{Trust: true}).Filter)
+//
+// The ID is stored in the Context, and echoed in the response headers.
+type RequestID struct {
+	// Header is the name of the header carrying the request ID. If empty,
+	// X-Request-ID is used.
+	Header string
+
+	// Trust enables accepting the request ID sent by the client in the
+	// Header. This should only be enabled when the header is set by a
+	// trusted proxy.
+	Trust bool
+
+	// Generate returns a new request ID. If nil, a random 128-bit hex
+	// encoded ID is generated.
+	Generate func() string
+}
+
+// Filter assigns the request ID, stores it in the Context and sets the
+// response header.
+func (m *RequestID) Filter(w http.ResponseWriter, r *http.Request) {
+	header := m.Header
+	if header == "" {
+		header = "X-Request-ID"
+	}
+
+	id := r.Header.Get(header)
+	if !m.Trust || !validRequestID(id) {
+		if m.Generate != nil {
+			id = m.Generate()
+		} else {
+			id = newRequestID()
+		}
+	}
+
+	NewContext(r).Values.Set(requestIDKey, id)
+	w.Header().Set(header, id)
+}
+
+// RequestID returns the ID assigned to the request by the RequestID filter,
+// or an empty string if no ID was assigned.
+func (c *Context) RequestID() string {
+	id, _ := c.Values.Get(requestIDKey).(string)
+	return id
+}
+
+// newRequestID returns a random 128-bit hex encoded request ID.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID reports whether an incoming request ID is safe to use.
+// The ID must be at most 128 characters of printable ASCII, excluding
+// spaces, so that it cannot be used to inject content into the logs.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRequestID tests that a request ID is generated, stored in the Context
+// and echoed in the response headers.
+func TestRequestID(t *testing.T) {
+	var id string
+
+	mux := NewRouter()
+	mux.Filter((&RequestID{}).Filter)
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		id = NewContext(r).RequestID()
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-ID", "spoofed")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if len(id) != 32 {
+		t.Errorf("request id set to [%s]; want a 32 character id", id)
+	}
+	if got := w.Header().Get("X-Request-ID"); got != id {
+		t.Errorf("X-Request-ID header set to [%s]; want [%s]", got, id)
+	}
+}
+
+// TestRequestIDTrusted tests that a valid request ID is accepted from the
+// configured header when trusted, and invalid IDs are replaced.
+func TestRequestIDTrusted(t *testing.T) {
+	mux := NewRouter()
+	mux.Filter((&RequestID{
+		Header:   "X-Trace",
+		Trust:    true,
+		Generate: func() string { return "generated" },
+	}).Filter)
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		Error(w, http.StatusTeapot)
+	})
+
+	tests := map[string]string{
+		"abc-123":                "abc-123",
+		"":                       "generated",
+		"abc\n123":               "generated",
+		"has space":              "generated",
+		strings.Repeat("x", 129): "generated",
+	}
+	for header, want := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Trace", header)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if got := w.Header().Get("X-Trace"); got != want {
+			t.Errorf("request id for [%q] set to [%s]; want [%s]", header, got, want)
+		}
+		if !strings.Contains(w.Body.String(), "(request id "+want+")") {
+			t.Errorf("error body [%s] does not include request id [%s]", w.Body.String(), want)
+		}
+	}
+}
@@ -1,16 +1,21 @@
 package routes
 
 import (
+	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"regexp"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"text/template"
+	"time"
+
+	"github.com/drone/routes/internal/static"
 )
 
 const (
+	CONNECT = "CONNECT"
 	DELETE  = "DELETE"
 	GET     = "GET"
 	HEAD    = "HEAD"
@@ -18,69 +23,131 @@ const (
 	PATCH   = "PATCH"
 	POST    = "POST"
 	PUT     = "PUT"
+	TRACE   = "TRACE"
 )
 
-type route struct {
+// Route is a handle to a route registered with the Router. It is used to
+// attach middleware filters that only apply to this route.
+type Route struct {
+	router  *Router
 	method  string
+	pattern string
 	regex   *regexp.Regexp
 	params  map[int]string
 	handler http.HandlerFunc
+	filters []http.HandlerFunc
+}
+
+// With adds middleware filters that are only executed for this Route. Route
+// filters run after the Router filters, and before the request handler.
+func (r *Route) With(filters ...http.HandlerFunc) *Route {
+	r.router.Lock()
+	r.filters = append(r.filters, filters...)
+	r.router.Unlock()
+	return r
+}
+
+// AfterFunc is a middleware filter that is executed after the request has
+// been handled, with the status code written to the response.
+type AfterFunc func(w http.ResponseWriter, r *http.Request, status int)
+
+// Middleware is implemented by filters that are executed both before the
+// request handler, and after the request has been handled.
+type Middleware interface {
+	Filter(w http.ResponseWriter, r *http.Request)
+	After(w http.ResponseWriter, r *http.Request, status int)
+}
+
+// ErrorFunc renders an error response with the given status code. It is
+// used by the Router for the responses it generates, such as 404 Not Found
+// or 500 Internal Server Error.
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, code int)
+
+// Panic describes a panic recovered while serving a request.
+type Panic struct {
+	Value   interface{} // the value passed to panic
+	Stack   []byte      // the stack trace of the goroutine
+	Pattern string      // the route pattern matched by the request
 }
 
+// PanicFunc is a hook that is invoked when a panic is recovered, for
+// example to report the panic to an error tracker.
+type PanicFunc func(r *http.Request, p *Panic)
+
 type Router struct {
 	sync.RWMutex
-	routes  []*route
-	filters []http.HandlerFunc
-	views   *template.Template
-	params  map[string]interface{}
+	routes   []*Route
+	filters  []http.HandlerFunc
+	after    []AfterFunc
+	errors   ErrorFunc
+	panics   []PanicFunc
+	tracer   Tracer
+	timing   func(req *http.Request) bool
+	timed    bool
+	codecs   []codec
+	decoding DecodeOptions
+	etags    ETagMode
+	assets   []*static.Server
+	mappings []errorMapping
+	hooks    []HandlerErrorFunc
+	views    *template.Template
+	params   map[string]interface{}
 }
 
 func NewRouter() *Router {
 	r := Router{}
 	r.params = make(map[string]interface{})
+	r.codecs = defaultCodecs
 	return &r
 }
 
 // Get adds a new Route for GET requests.
-func (r *Router) Get(pattern string, handler http.HandlerFunc) {
-	r.AddRoute(GET, pattern, handler)
+func (r *Router) Get(pattern string, handler http.HandlerFunc) *Route {
+	return r.AddRoute(GET, pattern, handler)
 }
 
 // Put adds a new Route for PUT requests.
-func (r *Router) Put(pattern string, handler http.HandlerFunc) {
-	r.AddRoute(PUT, pattern, handler)
+func (r *Router) Put(pattern string, handler http.HandlerFunc) *Route {
+	return r.AddRoute(PUT, pattern, handler)
 }
 
 // Del adds a new Route for DELETE requests.
-func (r *Router) Del(pattern string, handler http.HandlerFunc) {
-	r.AddRoute(DELETE, pattern, handler)
+func (r *Router) Del(pattern string, handler http.HandlerFunc) *Route {
+	return r.AddRoute(DELETE, pattern, handler)
 }
 
 // Patch adds a new Route for PATCH requests.
-func (r *Router) Patch(pattern string, handler http.HandlerFunc) {
-	r.AddRoute(PATCH, pattern, handler)
+func (r *Router) Patch(pattern string, handler http.HandlerFunc) *Route {
+	return r.AddRoute(PATCH, pattern, handler)
 }
 
 // Post adds a new Route for POST requests.
-func (r *Router) Post(pattern string, handler http.HandlerFunc) {
-	r.AddRoute(POST, pattern, handler)
-}
-
-// Adds a new Route for Static http requests. Serves
-// static files from the specified directory
-func (r *Router) Static(pattern string, dir string) {
-	//append a regex to the param to match everything
-	// that comes after the prefix
-	pattern = pattern + "(.+)"
-	r.Get(pattern, func(w http.ResponseWriter, req *http.Request) {
-		path := filepath.Clean(req.URL.Path)
-		path = filepath.Join(dir, path)
-		http.ServeFile(w, req, path)
-	})
+func (r *Router) Post(pattern string, handler http.HandlerFunc) *Route {
+	return r.AddRoute(POST, pattern, handler)
+}
+
+// Static adds a new Route for GET requests that serves the files of the
+// directory under the path prefix, as StaticDir does with the default
+// options.
+func (r *Router) Static(pattern string, dir string) *Route {
+	return r.StaticDir(pattern, dir, nil)
+}
+
+// StaticDir adds a new Route for GET requests that serves the files of the
+// directory under the path prefix, as StaticFS does. Files outside of the
+// directory are never served, even through symbolic links, and links with
+// an absolute target are refused, unlike the files of os.DirFS. It panics
+// if the directory cannot be opened.
+func (r *Router) StaticDir(pattern string, dir string, opts *StaticOptions) *Route {
+	fsys, err := static.DirFS(dir)
+	if err != nil {
+		panic(err)
+	}
+	return r.StaticFS(pattern, fsys, opts)
 }
 
 // Adds a new Route to the Handler
-func (r *Router) AddRoute(method string, pattern string, handler http.HandlerFunc) {
+func (r *Router) AddRoute(method string, pattern string, handler http.HandlerFunc) *Route {
 	r.Lock()
 	defer r.Unlock()
 
@@ -108,14 +175,16 @@ func (r *Router) AddRoute(method string, pattern string, handler http.HandlerFun
 
 	//recreate the url pattern, with parameters replaced
 	//by regular expressions. then compile the regex
-	pattern = strings.Join(parts, "/")
-	regex, regexErr := regexp.Compile(pattern)
+	expr := strings.Join(parts, "/")
+	regex, regexErr := regexp.Compile(expr)
 	if regexErr != nil {
 		panic(regexErr)
 	}
 
-	route := &route{
+	route := &Route{
+		router  : r,
 		method  : method,
+		pattern : pattern,
 		regex   : regex,
 		handler : handler,
 		params  : params,
@@ -123,6 +192,7 @@ func (r *Router) AddRoute(method string, pattern string, handler http.HandlerFun
 
 	//append to the list of Routes
 	r.routes = append(r.routes, route)
+	return route
 }
 
 // Filter adds the middleware filter.
@@ -132,6 +202,39 @@ func (r *Router) Filter(filter http.HandlerFunc) {
 	r.Unlock()
 }
 
+// After adds the middleware filter that is executed after the request has
+// been handled, even if the handler panics. Filters are executed in the
+// order they were added, after any hooks registered on the Context.
+func (r *Router) After(filter AfterFunc) {
+	r.Lock()
+	r.after = append(r.after, filter)
+	r.Unlock()
+}
+
+// Use adds the Middleware's Filter and After functions to the Router.
+func (r *Router) Use(m Middleware) {
+	r.Filter(m.Filter)
+	r.After(m.After)
+}
+
+// ErrorHandler sets the function used to render the error responses
+// generated by the Router, and by the Error function and response helpers.
+// By default a plain text response is written with the status text of the
+// code.
+func (r *Router) ErrorHandler(handler ErrorFunc) {
+	r.Lock()
+	r.errors = handler
+	r.Unlock()
+}
+
+// OnPanic adds a hook that is invoked when a panic is recovered while
+// serving a request.
+func (r *Router) OnPanic(hook PanicFunc) {
+	r.Lock()
+	r.panics = append(r.panics, hook)
+	r.Unlock()
+}
+
 // FilterParam adds the middleware filter iff the URL parameter exists.
 func (r *Router) FilterParam(param string, filter http.HandlerFunc) {
 	r.Filter(func(w http.ResponseWriter, req *http.Request) {
@@ -165,14 +268,42 @@ func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	defer r.RUnlock()
 
 	//wrap the response writer in our custom interface
-	w := &responseWriter{writer: rw, Router: r}
+	w := &responseWriter{writer: rw, Router: r, req: req, start: time.Now()}
+
+	//start the span of the request, if traced
+	w.span = r.startSpan(req)
+
+	//collect the Server-Timing metrics, if enabled
+	if r.timing != nil && r.timing(req) {
+		w.timing = &serverTiming{}
+	}
+
+	//the request context, once a matching route is found
+	var c *Context
+
+	//recover from panics, and execute the after filters once
+	//the request is handled
+	defer func() {
+		if err := recover(); err != nil {
+			if err == http.ErrAbortHandler {
+				r.complete(w, req, c, http.StatusInternalServerError)
+				panic(err)
+			}
+			r.recover(w, req, err)
+		}
+		r.complete(w, req, c, http.StatusOK)
+	}()
+
+	//serve HEAD requests with the GET routes, unless a HEAD route
+	//matches the url
+	method := r.method(req)
 
 	//find a matching Route
 	for _, route := range r.routes {
 
 		//if the methods don't match, skip this handler
 		//i.e if request.Method is 'PUT' Route.Method must be 'PUT'
-		if req.Method != route.method {
+		if method != route.method {
 			continue
 		}
 
@@ -190,48 +321,191 @@ func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		}
 
 		//create the http.Requests context
-		c := NewContext(req)
+		c = NewContext(req)
 
 		//add url parameters to the context
 		for i, match := range matches[1:] {
 			c.Params.Set(route.params[i], match)
 		}
 
+		//record the route pattern matched by the request
+		w.pattern = route.pattern
+
+		//name the span after the route, and add it to the context
+		if w.span != nil {
+			w.span.SetName(req.Method + " " + route.pattern)
+			w.span.SetAttribute("http.route", route.pattern)
+			c.Values.Set(spanKey, w.span)
+			c.Values.Set(tracerKey, r.tracer)
+		}
+		if w.timing != nil {
+			c.Values.Set(timingKey, w.timing)
+		}
+		c.Values.Set(codecsKey, r.codecs)
+		c.Values.Set(decodingKey, r.decoding)
+		c.Values.Set(etagsKey, r.etags)
+
 		//execute middleware filters
-		for _, filter := range r.filters {
-			filter(w, req)
+		for i, filter := range r.filters {
+			r.invoke(w, req, filterMetric(i), filter)
+			if w.started { return }
+		}
+
+		//execute the route specific middleware filters
+		for i, filter := range route.filters {
+			r.invoke(w, req, filterMetric(len(r.filters)+i), filter)
 			if w.started { return }
 		}
 
 		//invoke the request handler
-		route.handler(w, req)
+		r.invoke(w, req, "handler", route.handler)
+		return
+	}
+
+	//if the url matches routes for other methods, throw a
+	//method not allowed exception
+	if allow := r.allowed(req.URL.Path); len(allow) != 0 {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		r.error(w, req, http.StatusMethodNotAllowed)
 		return
 	}
 
 	//if no matches to url, throw a not found exception
 	if w.started == false {
-		http.NotFound(w, req)
+		r.error(w, req, http.StatusNotFound)
+	}
+}
+
+// match reports whether the route pattern matches the whole url path.
+func (r *Route) match(path string) bool {
+	matches := r.regex.FindStringSubmatch(path)
+	return len(matches) != 0 && len(matches[0]) == len(path)
+}
+
+// method returns the method of the routes that serve the request. HEAD
+// requests are served by the GET routes, unless a HEAD route matches the url
+// path.
+func (r *Router) method(req *http.Request) string {
+	if req.Method != HEAD {
+		return req.Method
+	}
+	for _, route := range r.routes {
+		if route.method == HEAD && route.match(req.URL.Path) {
+			return HEAD
+		}
+	}
+	return GET
+}
+
+// allowed returns the methods of the routes that match the url path,
+// including HEAD if GET is allowed.
+func (r *Router) allowed(path string) []string {
+	var methods []string
+	seen := make(map[string]bool)
+	for _, route := range r.routes {
+		if seen[route.method] || !route.match(path) {
+			continue
+		}
+		seen[route.method] = true
+		methods = append(methods, route.method)
+	}
+	if seen[GET] && !seen[HEAD] {
+		methods = append(methods, HEAD)
+	}
+	return methods
+}
+
+// invoke executes the filter or handler. If the request is traced, it is
+// executed in a child span of the request span, and if the handler metrics
+// of Server-Timing are enabled its duration is added to the header as the
+// named metric, described by the route pattern.
+func (r *Router) invoke(w *responseWriter, req *http.Request, metric string, handler http.HandlerFunc) {
+	timed := w.timing != nil && r.timed
+	if w.span == nil && !timed {
+		handler(w, req)
+		return
+	}
+
+	if w.span != nil {
+		span := r.tracer.Start(w.span.SpanContext(), funcName(handler))
+		defer span.End()
+	}
+	if timed {
+		defer w.timing.measure(metric, w.pattern)()
+	}
+	handler(w, req)
+}
+
+// complete executes the hooks registered on the Context, followed by the
+// after filters, and ends the span of the request. If the response has not
+// been written to, they receive the provided default status code.
+func (r *Router) complete(w *responseWriter, req *http.Request, c *Context, status int) {
+	if w.status != 0 {
+		status = w.status
+	} else if w.started {
+		status = http.StatusOK
+	}
+
+	if c != nil {
+		c.complete(w, req, status)
+	}
+
+	for _, filter := range r.after {
+		filter(w, req, status)
+	}
+
+	if w.span != nil {
+		w.span.SetAttribute("http.status_code", status)
+		w.span.End()
+	}
+}
+
+// error renders an error response with the given status code, using the
+// ErrorFunc configured for the Router.
+func (r *Router) error(w http.ResponseWriter, req *http.Request, code int) {
+	Error(w, code)
+}
+
+// recover handles a panic recovered while serving the request. The panic is
+// logged with the stack trace and matched route pattern, and reported to
+// the panic hooks. If the response has not been written to, a 500 error is
+// rendered.
+func (r *Router) recover(w *responseWriter, req *http.Request, err interface{}) {
+	p := &Panic{Value: err, Stack: debug.Stack(), Pattern: w.pattern}
+	log.Printf("routes: panic serving %s %s (route %q): %v\n%s", req.Method, req.URL.Path, p.Pattern, p.Value, p.Stack)
+
+	for _, hook := range r.panics {
+		hook(req, p)
+	}
+
+	if !w.started {
+		r.error(w, req, http.StatusInternalServerError)
 	}
 }
 
-// Template uses the provided template definitions.
+// Template uses a copy of the provided template definitions, so that they
+// are not changed by later calls to t.Parse. Templates that call the asset
+// function must be parsed with the functions of TemplateFuncs. It panics if
+// t has already been executed, since it can no longer be copied.
 func (r *Router) Template(t *template.Template) {
 	r.Lock()
 	defer r.Unlock()
 	r.views = template.Must(t.Clone())
 }
 
-// TemplateFiles parses the template definitions from the named files.
+// TemplateFiles parses the template definitions from the named files. The
+// asset function is available to the templates.
 func (r *Router) TemplateFiles(filenames ...string) {
 	r.Lock()
 	defer r.Unlock()
-	r.views = template.Must(template.ParseFiles(filenames...))
+	r.views = template.Must(template.New("").Funcs(r.TemplateFuncs()).ParseFiles(filenames...))
 }
 
 // TemplateGlob parses the template definitions from the files identified
-// by the pattern, which must match at least one file.
+// by the pattern, which must match at least one file. The asset function
+// is available to the templates.
 func (r *Router) TemplateGlob(pattern string) {
 	r.Lock()
 	defer r.Unlock()
-	r.views = template.Must(template.ParseGlob(pattern))
+	r.views = template.Must(template.New("").Funcs(r.TemplateFuncs()).ParseGlob(pattern))
 }
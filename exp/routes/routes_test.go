@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"text/template"
 )
 
 func HandlerOk(w http.ResponseWriter, r *http.Request) {
@@ -81,7 +83,7 @@ func TestRouteFilterHalt(t *testing.T) {
 	mux.ServeHTTP(w, r)
 
 	if w.Code != 400 {
-		t.Errorf("Code set to [%s]; want [%s]", w.Code, http.StatusBadRequest)
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusBadRequest)
 	}
 	if w.Body.String() == "hello world" {
 		t.Errorf("Body set to [%s]; want empty", w.Body.String())
@@ -120,7 +122,188 @@ func TestParam(t *testing.T) {
 		t.Errorf("Body set to [%s]; want empty", w.Body.String())
 	}
 	if w.Code != 400 {
-		t.Errorf("Code set to [%s]; want [%s]", w.Code, http.StatusBadRequest)
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusBadRequest)
+	}
+}
+
+// TestRouteWith tests that a route specific filter is only executed for the
+// route it is attached to, after the Router filters.
+func TestRouteWith(t *testing.T) {
+	mux := NewRouter()
+	mux.Filter(HandlerSetVar)
+	mux.Get("/person/:last/:first", HandlerOk).With(HandlerErr)
+	mux.Get("/:nickname", HandlerOk)
+
+	// the route filter SHOULD fire and halt the request
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != 400 {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusBadRequest)
+	}
+	if password := NewContext(r).Values.Get("password"); password != "z1on" {
+		t.Errorf("session variable set to [%s]; want [%s]", password, "z1on")
+	}
+
+	// the route filter should not fire for other routes
+	r, _ = http.NewRequest("GET", "/neo", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Body.String() != "hello world" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "hello world")
+	}
+}
+
+// TestRouteAfter tests that the after filters and Context hooks are executed
+// once the request is handled, with the hooks executed in LIFO order.
+func TestRouteAfter(t *testing.T) {
+	var calls []string
+	var code int
+
+	mux := NewRouter()
+	mux.Filter(func(w http.ResponseWriter, r *http.Request) {
+		c := NewContext(r)
+		c.OnComplete(func(w http.ResponseWriter, r *http.Request, status int) {
+			calls = append(calls, "first")
+		})
+		c.OnComplete(func(w http.ResponseWriter, r *http.Request, status int) {
+			calls = append(calls, "second")
+		})
+	})
+	mux.After(func(w http.ResponseWriter, r *http.Request, status int) {
+		calls = append(calls, "after")
+		code = status
+	})
+	mux.Get("/person/:last/:first", HandlerOk)
+
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if got := strings.Join(calls, ","); got != "second,first,after" {
+		t.Errorf("hooks executed in order [%s]; want [%s]", got, "second,first,after")
+	}
+	if code != http.StatusOK {
+		t.Errorf("after filter status set to [%v]; want [%v]", code, http.StatusOK)
+	}
+}
+
+// TestRouteAfterPanic tests that the after filters are executed when the
+// request handler panics.
+func TestRouteAfterPanic(t *testing.T) {
+	var code int
+
+	mux := NewRouter()
+	mux.After(func(w http.ResponseWriter, r *http.Request, status int) {
+		code = status
+	})
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		panic("there is no spoon")
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if code != http.StatusInternalServerError {
+		t.Errorf("after filter status set to [%v]; want [%v]", code, http.StatusInternalServerError)
+	}
+}
+
+// TestRouteRecover tests that a panic is recovered, reported to the panic
+// hooks, and rendered using the Router's error handler.
+func TestRouteRecover(t *testing.T) {
+	var recovered *Panic
+
+	mux := NewRouter()
+	mux.OnPanic(func(r *http.Request, p *Panic) {
+		recovered = p
+	})
+	mux.ErrorHandler(func(w http.ResponseWriter, r *http.Request, code int) {
+		w.WriteHeader(code)
+		fmt.Fprintf(w, "error %d", code)
+	})
+	mux.Get("/person/:last/:first", func(w http.ResponseWriter, r *http.Request) {
+		panic("there is no spoon")
+	})
+
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusInternalServerError)
+	}
+	if w.Body.String() != "error 500" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "error 500")
+	}
+	if recovered == nil {
+		t.Fatalf("panic hook was not invoked")
+	}
+	if recovered.Value != "there is no spoon" {
+		t.Errorf("panic value set to [%v]; want [%v]", recovered.Value, "there is no spoon")
+	}
+	if recovered.Pattern != "/person/:last/:first" {
+		t.Errorf("panic pattern set to [%s]; want [%s]", recovered.Pattern, "/person/:last/:first")
+	}
+
+	// the error handler is also used for routes that are not found
+	r, _ = http.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Body.String() != "error 404" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "error 404")
+	}
+}
+
+// TestTemplateRecover tests that a template execution error is recovered,
+// and a 500 error is rendered.
+func TestTemplateRecover(t *testing.T) {
+	mux := NewRouter()
+	mux.Template(template.Must(template.New("index.html").Parse("{{ .Name }}")))
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		ServeTemplate(w, "missing.html", nil)
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusInternalServerError)
+	}
+}
+
+// wrappedWriter wraps the writer of the Router, as a middleware would.
+type wrappedWriter struct{ http.ResponseWriter }
+
+func (w wrappedWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// TestTemplateWrapped tests that templates are rendered to a writer wrapped
+// by a middleware, and that a 500 error is rendered outside of a Router.
+func TestTemplateWrapped(t *testing.T) {
+	mux := NewRouter()
+	mux.Template(template.Must(template.New("index.html").Parse("{{ .Name }}")))
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		ServeTemplate(wrappedWriter{w}, "index.html", map[string]interface{}{"Name": "Morpheus"})
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Body.String() != "Morpheus" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "Morpheus")
+	}
+
+	w = httptest.NewRecorder()
+	ServeTemplate(w, "index.html", nil)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusInternalServerError)
 	}
 }
 
@@ -154,7 +337,7 @@ func TestNotFound(t *testing.T) {
 	mux.ServeHTTP(w, r)
 
 	if w.Code != http.StatusNotFound {
-		t.Errorf("Code set to [%s]; want [%s]", w.Code, http.StatusNotFound)
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusNotFound)
 	}
 }
 
@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"io/fs"
+	"net/http"
+
+	"github.com/drone/routes/internal/static"
+)
+
+// StaticOptions configure how StaticFS serves files.
+type StaticOptions struct {
+	// Index are the names of the files served for a directory, in order of
+	// preference. If empty, index.html is served.
+	Index []string
+
+	// Browse enables the listing of directories without an index file.
+	// Otherwise they are not found.
+	Browse bool
+
+	// Hidden enables serving the files and directories whose name starts
+	// with a dot, such as .well-known. Otherwise they are not found, so that
+	// files such as .env or .git/config are never served.
+	Hidden bool
+
+	// SPA enables the fallback of single-page applications: requests for
+	// files that do not exist, and whose name has no extension, are served
+	// the index file of the root directory, so that the application can
+	// handle its own routes. Requests for missing assets, such as /app.js,
+	// are still not found.
+	SPA bool
+
+	// Precompressed enables serving the precompressed siblings of files,
+	// such as app.js.br or app.js.gz, to the clients that accept their
+	// encoding.
+	Precompressed bool
+
+	// CacheControl are the Cache-Control policies of the files. The first
+	// policy that matches the path of a file is applied.
+	CacheControl []CachePolicy
+
+	// Fingerprint enables serving the files at URLs that include a hash of
+	// their content, such as site.3f9a2c1b.css, with immutable caching. The
+	// files are hashed when the route is added, and their URLs are returned
+	// by Asset. The files are still served at their original URLs.
+	Fingerprint bool
+}
+
+// Cache-Control values for common policies.
+const (
+	CacheImmutable = static.CacheImmutable // fingerprinted files that never change
+	CacheNoCache   = static.CacheNoCache   // files that must be revalidated
+)
+
+// CachePolicy sets the Cache-Control header of the static files that match
+// a pattern, for example:
+//
+//	[]routes.CachePolicy{
+//		{Pattern: "index.html", Value: routes.CacheNoCache},
+//		{Pattern: "assets/*", Value: routes.CacheImmutable},
+//	}
+type CachePolicy struct {
+	// Pattern matches the path of the file, relative to the root, with the
+	// syntax of path.Match. A pattern without a slash matches the name of
+	// the file in any directory, such as *.html.
+	Pattern string
+
+	// Value is the Cache-Control header value.
+	Value string
+}
+
+// StaticFS adds a new Route for GET requests that serves the files of the
+// file system under the path prefix, for example the files embedded in the
+// binary:
+//
+//	//go:embed dist
+//	var dist embed.FS
+//
+//	assets, _ := fs.Sub(dist, "dist")
+//	r.StaticFS("/app", assets, &routes.StaticOptions{SPA: true})
+//
+// A request for /app/css/site.css is served the file css/site.css. If opts
+// is nil, the default options are used. The prefix is matched literally,
+// and it panics if the prefix contains a parameter, or if the files are
+// fingerprinted and cannot be listed or read.
+func (r *Router) StaticFS(pattern string, fsys fs.FS, opts *StaticOptions) *Route {
+	if opts == nil {
+		opts = &StaticOptions{}
+	}
+	s, err := static.New(pattern, fsys, opts.options(), func(w http.ResponseWriter, req *http.Request, code int) {
+		Error(w, code)
+	})
+	if err != nil {
+		panic(err)
+	}
+	if opts.Fingerprint {
+		r.Lock()
+		r.assets = append(r.assets, s)
+		r.Unlock()
+	}
+	return r.Get(s.Pattern(), s.ServeHTTP)
+}
+
+// options returns the options of the static file server.
+func (opts *StaticOptions) options() static.Options {
+	o := static.Options{
+		Index:         opts.Index,
+		Browse:        opts.Browse,
+		Hidden:        opts.Hidden,
+		SPA:           opts.SPA,
+		Precompressed: opts.Precompressed,
+		Fingerprint:   opts.Fingerprint,
+	}
+	for _, policy := range opts.CacheControl {
+		o.CacheControl = append(o.CacheControl, static.CachePolicy(policy))
+	}
+	return o
+}
@@ -0,0 +1,247 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var staticFS = fstest.MapFS{
+	"index.html":       {Data: []byte("<h1>home</h1>")},
+	"app.js":           {Data: []byte("console.log('app')")},
+	"css/site.css":     {Data: []byte("body{}")},
+	"docs/default.htm": {Data: []byte("<h1>docs</h1>")},
+	"files/a.txt":      {Data: []byte("a")},
+	"files/b <c>.txt":  {Data: []byte("b")},
+}
+
+// TestStaticFS tests that files are served from the file system, with the
+// index files, directory listings and single-page application fallback.
+func TestStaticFS(t *testing.T) {
+	mux := NewRouter()
+	mux.StaticFS("/static/", staticFS, nil)
+	mux.StaticFS("/browse", staticFS, &StaticOptions{Browse: true, Index: []string{"index.html", "default.htm"}})
+	mux.StaticFS("/app", staticFS, &StaticOptions{SPA: true})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/static/app.js", http.StatusOK, "console.log('app')"},
+		{"/static/css/site.css", http.StatusOK, "body{}"},
+		{"/static/", http.StatusOK, "<h1>home</h1>"},
+		{"/static", http.StatusMovedPermanently, ""},
+		{"/static/css", http.StatusMovedPermanently, ""},
+		{"/static/css/", http.StatusNotFound, ""},
+		{"/static/docs/", http.StatusNotFound, ""},
+		{"/static/missing.js", http.StatusNotFound, ""},
+		{"/static/css/../app.js", http.StatusOK, "console.log('app')"},
+		{"/static/../../routes.go", http.StatusNotFound, ""},
+		{"/staticfile", http.StatusNotFound, ""},
+		{"/browse/docs/", http.StatusOK, "<h1>docs</h1>"},
+		{"/browse/files/", http.StatusOK, `<a href="b%20%3Cc%3E.txt">b &lt;c&gt;.txt</a>`},
+		{"/app/users/42", http.StatusOK, "<h1>home</h1>"},
+		{"/app/app.js", http.StatusOK, "console.log('app')"},
+		{"/app/missing.js", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", test.path, w.Code, test.code)
+		}
+		if test.body != "" && !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s body set to [%s]; want [%s]", test.path, w.Body.String(), test.body)
+		}
+	}
+
+	r, _ := http.NewRequest("GET", "/static/css?v=1", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if got := w.Header().Get("Location"); got != "css/?v=1" {
+		t.Errorf("Location set to [%s]; want [css/?v=1]", got)
+	}
+}
+
+// TestStaticPrefix tests that the prefix is matched literally, so that a
+// dotted prefix does not match other paths.
+func TestStaticPrefix(t *testing.T) {
+	mux := NewRouter()
+	mux.StaticFS("/v1.0", staticFS, nil)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/v1.0/app.js", http.StatusOK},
+		{"/v1x0/app.js", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", test.path, w.Code, test.code)
+		}
+	}
+}
+
+// TestStaticPrecompressed tests that precompressed siblings are served to
+// clients that accept their encoding, with the Cache-Control policies.
+func TestStaticPrecompressed(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":         {Data: []byte("<h1>home</h1>")},
+		"assets/app.js":      {Data: []byte("console.log('app')")},
+		"assets/app.js.br":   {Data: []byte("brotli")},
+		"assets/app.js.gz":   {Data: []byte("gzip")},
+		"assets/site.css":    {Data: []byte("body{}")},
+		"assets/site.css.gz": {Data: []byte("gzip")},
+	}
+
+	mux := NewRouter()
+	mux.StaticFS("/static", files, &StaticOptions{
+		Precompressed: true,
+		CacheControl: []CachePolicy{
+			{Pattern: "index.html", Value: CacheNoCache},
+			{Pattern: "assets/*", Value: CacheImmutable},
+		},
+	})
+
+	tests := []struct {
+		path     string
+		accept   string
+		body     string
+		encoding string
+		ctype    string
+		cache    string
+	}{
+		{"/static/assets/app.js", "gzip, deflate, br", "brotli", "br", "text/javascript; charset=utf-8", CacheImmutable},
+		{"/static/assets/app.js", "br;q=0.5, gzip", "gzip", "gzip", "text/javascript; charset=utf-8", CacheImmutable},
+		{"/static/assets/app.js", "identity", "console.log('app')", "", "text/javascript; charset=utf-8", CacheImmutable},
+		{"/static/assets/site.css", "br", "body{}", "", "text/css; charset=utf-8", CacheImmutable},
+		{"/static/assets/site.css", "*", "gzip", "gzip", "text/css; charset=utf-8", CacheImmutable},
+		{"/static/", "gzip", "<h1>home</h1>", "", "text/html; charset=utf-8", CacheNoCache},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept-Encoding", test.accept)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		name := test.path + " " + test.accept
+		if w.Body.String() != test.body {
+			t.Errorf("%s body set to [%s]; want [%s]", name, w.Body.String(), test.body)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("%s Content-Encoding set to [%s]; want [%s]", name, got, test.encoding)
+		}
+		if got := w.Header().Get("Content-Type"); got != test.ctype {
+			t.Errorf("%s Content-Type set to [%s]; want [%s]", name, got, test.ctype)
+		}
+		if got := w.Header().Get("Cache-Control"); got != test.cache {
+			t.Errorf("%s Cache-Control set to [%s]; want [%s]", name, got, test.cache)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s Vary set to [%s]; want [Accept-Encoding]", name, got)
+		}
+	}
+}
+
+// TestStaticHardened tests that static files outside of the root directory
+// are never served, even through symbolic links, and that hidden files and
+// directory listings are not served by default.
+func TestStaticHardened(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "public")
+	files := map[string]string{
+		"secret.txt":                      "secret",
+		"public/app.js":                   "app",
+		"public/.env":                     "TOKEN=secret",
+		"public/.git/config":              "[core]",
+		"public/docs/guide.txt":           "guide",
+		"public/.well-known/security.txt": "contact",
+	}
+	for name, data := range files {
+		file := filepath.Join(base, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		os.WriteFile(file, []byte(data), 0644)
+	}
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(root, "leak.txt")); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+	os.Symlink(base, filepath.Join(root, "parent"))
+	os.Symlink("app.js", filepath.Join(root, "alias.js"))
+
+	mux := NewRouter()
+	mux.Static("/static", root)
+	mux.StaticDir("/browse", root, &StaticOptions{Browse: true})
+	mux.StaticDir("/hidden", root, &StaticOptions{Browse: true, Hidden: true})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/static/app.js", http.StatusOK, "app"},
+		{"/static/alias.js", http.StatusOK, "app"},
+		{"/static/static/app.js", http.StatusNotFound, ""},
+		{"/static/../secret.txt", http.StatusNotFound, ""},
+		{"/static/%2e%2e/secret.txt", http.StatusNotFound, ""},
+		{"/static/..%2fsecret.txt", http.StatusNotFound, ""},
+		{"/static/leak.txt", http.StatusNotFound, ""},
+		{"/static/parent/secret.txt", http.StatusNotFound, ""},
+		{"/static/app.js%00.txt", http.StatusNotFound, ""},
+		{"/static/.env", http.StatusNotFound, ""},
+		{"/static/.git/config", http.StatusNotFound, ""},
+		{"/static/.git/", http.StatusNotFound, ""},
+		{"/static/docs/", http.StatusNotFound, ""},
+		{"/browse/docs/", http.StatusOK, "guide.txt"},
+		{"/browse/.git/", http.StatusNotFound, ""},
+		{"/hidden/.well-known/security.txt", http.StatusOK, "contact"},
+		{"/hidden/parent/secret.txt", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s code set to [%v]; want [%v]", test.path, w.Code, test.code)
+		}
+		if test.body != "" && !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s body set to [%s]; want [%s]", test.path, w.Body.String(), test.body)
+		}
+		if strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("%s body set to [%s]; want no secret", test.path, w.Body.String())
+		}
+	}
+
+	// hidden files are not listed
+	r, _ := http.NewRequest("GET", "/browse/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if body := w.Body.String(); !strings.Contains(body, "app.js") || strings.Contains(body, ".env") || strings.Contains(body, ".git") {
+		t.Errorf("Listing set to [%s]; want no hidden files", body)
+	}
+}
+
+// TestStaticMissing tests that Static panics when the directory cannot be
+// opened, rather than serving 404 for every request.
+func TestStaticMissing(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Static did not panic for a missing directory")
+		}
+	}()
+	NewRouter().Static("/static", filepath.Join(t.TempDir(), "missing"))
+}
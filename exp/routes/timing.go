@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key used to store the Server-Timing metrics in the Context
+const timingKey = "_timing"
+
+// ServerTiming enables the Server-Timing response header for the requests
+// accepted by the allow function, for example requests from trusted
+// clients. The header reports template execution and any timing added with
+// Context.Timing. If allow is nil, the header is disabled.
+func (r *Router) ServerTiming(allow func(req *http.Request) bool) {
+	r.Lock()
+	r.timing = allow
+	r.Unlock()
+}
+
+// ServerTimingHandlers enables the duration of each filter and the handler
+// in the Server-Timing header. The metrics are named handler, and filter-0,
+// filter-1 and so on by the position of the filter in the order of
+// execution, and described by the route pattern, so that the names of the
+// functions are never exposed to the clients.
+//
+// The header is written with the response headers, so the handler duration
+// is measured until the first write to the response.
+func (r *Router) ServerTimingHandlers(enabled bool) {
+	r.Lock()
+	r.timed = enabled
+	r.Unlock()
+}
+
+// Timing adds a named duration to the Server-Timing header, for example to
+// report the time spent querying the database. It has no effect if the
+// Server-Timing header is not enabled for the request, or the response has
+// already been written to.
+func (c *Context) Timing(name string, d time.Duration) {
+	if t, ok := c.Values.Get(timingKey).(*serverTiming); ok {
+		t.add(name, "", d)
+	}
+}
+
+// filterMetric returns the name of the Server-Timing metric of the filter at
+// position i in the order of execution.
+func filterMetric(i int) string {
+	return "filter-" + strconv.Itoa(i)
+}
+
+// serverTiming collects the metrics of the Server-Timing header.
+type serverTiming struct {
+	sync.Mutex
+	metrics []timingMetric
+	current *timingMetric // the filter or handler being executed
+	started time.Time     // start time of the current filter or handler
+}
+
+type timingMetric struct {
+	name string
+	desc string
+	dur  time.Duration
+}
+
+// add adds the metric to the Server-Timing header.
+func (t *serverTiming) add(name, desc string, d time.Duration) {
+	t.Lock()
+	t.metrics = append(t.metrics, timingMetric{name: name, desc: desc, dur: d})
+	t.Unlock()
+}
+
+// measure starts measuring a filter or handler, and returns the function
+// that adds the metric once it returns.
+func (t *serverTiming) measure(name, desc string) func() {
+	start := time.Now()
+	t.Lock()
+	t.current = &timingMetric{name: name, desc: desc}
+	t.started = start
+	t.Unlock()
+
+	return func() {
+		t.Lock()
+		t.current = nil
+		t.Unlock()
+		t.add(name, desc, time.Since(start))
+	}
+}
+
+// header formats the Server-Timing header. The filter or handler being
+// executed is measured up to now.
+func (t *serverTiming) header() string {
+	t.Lock()
+	defer t.Unlock()
+
+	metrics := t.metrics
+	if t.current != nil {
+		current := *t.current
+		current.dur = time.Since(t.started)
+		metrics = append(metrics[:len(metrics):len(metrics)], current)
+	}
+
+	parts := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		part := m.name + ";dur=" + strconv.FormatFloat(float64(m.dur)/float64(time.Millisecond), 'f', 3, 64)
+		if m.desc != "" {
+			part += ";desc=" + strconv.Quote(m.desc)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func FilterTiming(w http.ResponseWriter, r *http.Request) {}
+
+// TestServerTiming tests that the Server-Timing header reports the filters,
+// handler, template and custom timings of the request.
+func TestServerTiming(t *testing.T) {
+	mux := NewRouter()
+	mux.ServerTiming(func(r *http.Request) bool { return true })
+	mux.ServerTimingHandlers(true)
+	mux.Template(template.Must(template.New("index.html").Parse("{{ .Name }}")))
+	mux.Filter(FilterTiming)
+	mux.Get("/person/:name", func(w http.ResponseWriter, r *http.Request) {
+		NewContext(r).Timing("db", 5*time.Millisecond)
+		ServeTemplate(w, "index.html", map[string]interface{}{"Name": "Morpheus"})
+	})
+
+	r, _ := http.NewRequest("GET", "/person/morpheus", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	header := w.Header().Get("Server-Timing")
+	metrics := strings.Split(header, ", ")
+	if len(metrics) != 4 {
+		t.Fatalf("Server-Timing set to [%s]; want [%d] metrics", header, 4)
+	}
+	if !strings.HasPrefix(metrics[0], "filter-0;dur=") || !strings.HasSuffix(metrics[0], `;desc="/person/:name"`) {
+		t.Errorf("filter metric set to [%s]; want the route pattern", metrics[0])
+	}
+	if metrics[1] != "db;dur=5.000" {
+		t.Errorf("db metric set to [%s]; want [%s]", metrics[1], "db;dur=5.000")
+	}
+	if !strings.HasPrefix(metrics[2], "template;dur=") || !strings.HasSuffix(metrics[2], `;desc="index.html"`) {
+		t.Errorf("template metric set to [%s]; want the index.html template", metrics[2])
+	}
+	if !strings.HasPrefix(metrics[3], "handler;dur=") || !strings.HasSuffix(metrics[3], `;desc="/person/:name"`) {
+		t.Errorf("handler metric set to [%s]; want the route pattern", metrics[3])
+	}
+	if w.Body.String() != "Morpheus" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "Morpheus")
+	}
+}
+
+// TestServerTimingFilters tests that each filter is reported as a distinct
+// metric, in the order of execution.
+func TestServerTimingFilters(t *testing.T) {
+	mux := NewRouter()
+	mux.ServerTiming(func(r *http.Request) bool { return true })
+	mux.ServerTimingHandlers(true)
+	mux.Filter(FilterTiming)
+	mux.Get("/", HandlerOk).With(FilterTiming)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	header := w.Header().Get("Server-Timing")
+	metrics := strings.Split(header, ", ")
+	if len(metrics) != 3 {
+		t.Fatalf("Server-Timing set to [%s]; want [%d] metrics", header, 3)
+	}
+	for i, name := range []string{"filter-0;", "filter-1;", "handler;"} {
+		if !strings.HasPrefix(metrics[i], name) {
+			t.Errorf("metric %d set to [%s]; want [%s]", i, metrics[i], name)
+		}
+	}
+}
+
+// TestServerTimingDisabled tests that the Server-Timing header is not added
+// to requests rejected by the allow function, and reports the handler only
+// if enabled.
+func TestServerTimingDisabled(t *testing.T) {
+	mux := NewRouter()
+	mux.ServerTiming(func(r *http.Request) bool { return r.Header.Get("X-Debug") == "1" })
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		NewContext(r).Timing("db", time.Millisecond)
+		HandlerOk(w, r)
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if header := w.Header().Get("Server-Timing"); header != "" {
+		t.Errorf("Server-Timing set to [%s]; want empty", header)
+	}
+
+	r.Header.Set("X-Debug", "1")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if header := w.Header().Get("Server-Timing"); header != "db;dur=1.000" {
+		t.Errorf("Server-Timing set to [%s]; want [db;dur=1.000]", header)
+	}
+}
@@ -0,0 +1,315 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"maps"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys used to store the tracing state in the Context
+const (
+	spanKey   = "_span"
+	tracerKey = "_tracer"
+)
+
+// Tracer creates the spans that trace the requests handled by the Router.
+// The Router starts a span for every request, named after the matched route
+// pattern, with a child span for each filter and the request handler.
+//
+// The Tracer interface is intentionally small, so that it can be adapted to
+// a tracing library such as OpenTelemetry.
+type Tracer interface {
+	// Start starts a new span with the given name. If the parent
+	// SpanContext is valid the span is a child of the parent, otherwise a
+	// new trace is started.
+	Start(parent SpanContext, name string) Span
+}
+
+// Span is a single operation within a trace.
+type Span interface {
+	// SpanContext returns the identity of the span.
+	SpanContext() SpanContext
+
+	// SetName changes the name of the span.
+	SetName(name string)
+
+	// SetAttribute sets an attribute of the span.
+	SetAttribute(key string, value interface{})
+
+	// End completes the span.
+	End()
+}
+
+// TraceID is the identifier of a trace.
+type TraceID [16]byte
+
+// String returns the hex encoding of the TraceID.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID is the identifier of a span.
+type SpanID [8]byte
+
+// String returns the hex encoding of the SpanID.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext identifies a span, and is propagated between services using
+// the W3C traceparent and tracestate headers.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool   // the sampled flag of the trace
+	State   string // the vendor specific tracestate
+	Remote  bool   // the SpanContext was propagated from a remote parent
+}
+
+// IsValid reports whether the SpanContext has a non-zero TraceID and SpanID.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Trace sets the Tracer used to trace the requests handled by the Router.
+func (r *Router) Trace(tracer Tracer) {
+	r.Lock()
+	r.tracer = tracer
+	r.Unlock()
+}
+
+// startSpan starts the span of the request, as a child of the span
+// propagated in the request headers. It returns nil if the Router does not
+// have a Tracer.
+func (r *Router) startSpan(req *http.Request) Span {
+	if r.tracer == nil {
+		return nil
+	}
+	parent, _ := Extract(req.Header)
+	span := r.tracer.Start(parent, req.Method)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.target", req.URL.Path)
+	return span
+}
+
+// Span returns the span of the request. If the request is not traced, a
+// Span that records nothing is returned.
+func (c *Context) Span() Span {
+	if span, ok := c.Values.Get(spanKey).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// StartSpan starts a child span of the request span, for example to trace
+// a database query made by the handler. The caller must End the span.
+func (c *Context) StartSpan(name string) Span {
+	if tracer, ok := c.Values.Get(tracerKey).(Tracer); ok {
+		return tracer.Start(c.Span().SpanContext(), name)
+	}
+	return noopSpan{}
+}
+
+// noopSpan is a Span that records nothing.
+type noopSpan struct{}
+
+func (noopSpan) SpanContext() SpanContext                   { return SpanContext{} }
+func (noopSpan) SetName(name string)                        {}
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) End()                                       {}
+
+// funcName returns the name of the function, used to name the child spans
+// of the filters and handlers.
+func funcName(fn interface{}) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "handler"
+}
+
+// W3C Trace Context Propagation -----------------------------------------------
+
+// Extract parses the W3C traceparent and tracestate headers. It returns false
+// if the traceparent header is missing or invalid.
+func Extract(h http.Header) (SpanContext, bool) {
+	var sc SpanContext
+
+	// traceparent: version "-" trace-id "-" parent-id "-" trace-flags
+	v := strings.TrimSpace(h.Get("traceparent"))
+	if len(v) < 55 || (len(v) > 55 && v[55] != '-') {
+		return sc, false
+	}
+	version, err := hex.DecodeString(v[0:2])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(v) != 55) {
+		return sc, false
+	}
+	if v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return sc, false
+	}
+	if !lowerHex(v[3:35]) || !lowerHex(v[36:52]) || !lowerHex(v[53:55]) {
+		return sc, false
+	}
+	hex.Decode(sc.TraceID[:], []byte(v[3:35]))
+	hex.Decode(sc.SpanID[:], []byte(v[36:52]))
+	flags, _ := hex.DecodeString(v[53:55])
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+
+	sc.Sampled = flags[0]&1 == 1
+	sc.Remote = true
+	if state := strings.Join(h.Values("tracestate"), ","); len(state) <= 512 {
+		sc.State = state
+	}
+	return sc, true
+}
+
+// Inject sets the W3C traceparent and tracestate headers, for example to
+// propagate the trace to an outgoing request.
+func Inject(h http.Header, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	h.Set("traceparent", "00-"+sc.TraceID.String()+"-"+sc.SpanID.String()+"-"+flags)
+	if sc.State != "" {
+		h.Set("tracestate", sc.State)
+	} else {
+		h.Del("tracestate")
+	}
+}
+
+// lowerHex reports whether s contains only lowercase hex digits.
+func lowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// In-Memory Tracer ------------------------------------------------------------
+
+// SpanData is a completed span recorded by the in-memory Tracer.
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]interface{}
+}
+
+// Exporter receives the spans completed by the in-memory Tracer.
+type Exporter interface {
+	Export(span *SpanData)
+}
+
+// NewTracer returns a Tracer that generates random trace and span IDs, and
+// sends completed spans to the Exporter.
+func NewTracer(exporter Exporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter Exporter
+}
+
+func (t *tracer) Start(parent SpanContext, name string) Span {
+	s := &span{tracer: t}
+	s.data.Name = name
+	s.data.Start = time.Now()
+	s.data.Attributes = make(map[string]interface{})
+	s.data.SpanContext.Sampled = true
+
+	if parent.IsValid() {
+		s.data.Parent = parent
+		s.data.SpanContext.TraceID = parent.TraceID
+		s.data.SpanContext.Sampled = parent.Sampled
+		s.data.SpanContext.State = parent.State
+	} else {
+		rand.Read(s.data.SpanContext.TraceID[:])
+	}
+	rand.Read(s.data.SpanContext.SpanID[:])
+	return s
+}
+
+type span struct {
+	sync.Mutex
+	tracer *tracer
+	data   SpanData
+	ended  bool
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) SetName(name string) {
+	s.Lock()
+	s.data.Name = name
+	s.Unlock()
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.Lock()
+	s.data.Attributes[key] = value
+	s.Unlock()
+}
+
+func (s *span) End() {
+	s.Lock()
+	if s.ended {
+		s.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	// the exported span must not share the attributes of the live span,
+	// which may still be set, for example by an After filter
+	data.Attributes = maps.Clone(s.data.Attributes)
+	s.Unlock()
+
+	if s.tracer.exporter != nil {
+		s.tracer.exporter.Export(&data)
+	}
+}
+
+// MemoryExporter is an Exporter that stores the completed spans in memory.
+// It is intended for tests.
+type MemoryExporter struct {
+	sync.Mutex
+	spans []*SpanData
+}
+
+// Export stores the completed span.
+func (e *MemoryExporter) Export(span *SpanData) {
+	e.Lock()
+	e.spans = append(e.spans, span)
+	e.Unlock()
+}
+
+// Spans returns the completed spans, in the order they were completed.
+func (e *MemoryExporter) Spans() []*SpanData {
+	e.Lock()
+	defer e.Unlock()
+	return append([]*SpanData(nil), e.spans...)
+}
+
+// Reset removes the stored spans.
+func (e *MemoryExporter) Reset() {
+	e.Lock()
+	e.spans = nil
+	e.Unlock()
+}
@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func FilterTrace(w http.ResponseWriter, r *http.Request) {}
+
+// TestTrace tests that a span is created for the request, named after the
+// matched route, with child spans for the filters and handler.
+func TestTrace(t *testing.T) {
+	exporter := &MemoryExporter{}
+
+	mux := NewRouter()
+	mux.Trace(NewTracer(exporter))
+	mux.Filter(FilterTrace)
+	mux.Get("/person/:last/:first", func(w http.ResponseWriter, r *http.Request) {
+		span := NewContext(r).StartSpan("db")
+		span.End()
+		HandlerOk(w, r)
+	})
+
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	mux.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := exporter.Spans()
+	if len(spans) != 4 {
+		t.Fatalf("exported [%d] spans; want [%d]", len(spans), 4)
+	}
+	filter, db, handler, server := spans[0], spans[1], spans[2], spans[3]
+
+	if server.Name != "GET /person/:last/:first" {
+		t.Errorf("span name set to [%s]; want [%s]", server.Name, "GET /person/:last/:first")
+	}
+	if server.Attributes["http.status_code"] != http.StatusOK {
+		t.Errorf("span status set to [%v]; want [%v]", server.Attributes["http.status_code"], http.StatusOK)
+	}
+	if server.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("span trace id set to [%s]; want [%s]", server.SpanContext.TraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+	}
+	if server.Parent.SpanID.String() != "00f067aa0ba902b7" || !server.Parent.Remote {
+		t.Errorf("span parent set to [%s]; want remote parent [%s]", server.Parent.SpanID, "00f067aa0ba902b7")
+	}
+	if server.SpanContext.State != "congo=t61rcWkgMzE" {
+		t.Errorf("span tracestate set to [%s]; want [%s]", server.SpanContext.State, "congo=t61rcWkgMzE")
+	}
+	if !strings.HasSuffix(filter.Name, ".FilterTrace") {
+		t.Errorf("filter span name set to [%s]; want suffix [%s]", filter.Name, ".FilterTrace")
+	}
+	for _, child := range []*SpanData{filter, handler} {
+		if child.Parent.SpanID != server.SpanContext.SpanID {
+			t.Errorf("span [%s] is not a child of the request span", child.Name)
+		}
+	}
+	if db.Name != "db" || db.Parent.SpanID != server.SpanContext.SpanID {
+		t.Errorf("span [%s] is not a child of the request span", db.Name)
+	}
+}
+
+// TestSpanEnd tests that the attributes set after the span has ended do
+// not change the exported span, or race with the exporter.
+func TestSpanEnd(t *testing.T) {
+	exporter := &MemoryExporter{}
+	span := NewTracer(exporter).Start(SpanContext{}, "request")
+	span.SetAttribute("http.status_code", 200)
+	span.End()
+
+	done := make(chan struct{})
+	go func() {
+		span.SetAttribute("late", true)
+		close(done)
+	}()
+	_ = exporter.Spans()[0].Attributes["late"]
+	<-done
+
+	attrs := exporter.Spans()[0].Attributes
+	if _, ok := attrs["late"]; ok || attrs["http.status_code"] != 200 {
+		t.Errorf("exported attributes set to [%v]; want [map[http.status_code:200]]", attrs)
+	}
+}
+
+// TestTraceContext tests parsing and formatting the W3C traceparent header.
+func TestTraceContext(t *testing.T) {
+	valid := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	h := http.Header{}
+	h.Set("traceparent", valid)
+	sc, ok := Extract(h)
+	if !ok || !sc.Sampled {
+		t.Fatalf("failed to extract valid traceparent [%s]", valid)
+	}
+
+	out := http.Header{}
+	Inject(out, sc)
+	if out.Get("traceparent") != valid {
+		t.Errorf("traceparent set to [%s]; want [%s]", out.Get("traceparent"), valid)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+	} {
+		h.Set("traceparent", invalid)
+		if _, ok := Extract(h); ok {
+			t.Errorf("extracted invalid traceparent [%s]", invalid)
+		}
+	}
+
+	// future versions may append fields
+	h.Set("traceparent", "01"+valid[2:]+"-extra")
+	if _, ok := Extract(h); !ok {
+		t.Errorf("failed to extract future version traceparent")
+	}
+}
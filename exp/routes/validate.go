@@ -0,0 +1,425 @@
+package routes
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Rule validates a value with the parameter of the rule, for example "10"
+// for max=10. It returns an error describing why the value is invalid, such
+// as "must be at most 10". Pointers are dereferenced before the rule is
+// applied, and rules are not applied to nil pointers.
+type Rule func(v reflect.Value, param string) error
+
+// rules are the validation rules, by name, and the rules parsed from the
+// validate tags of each struct type.
+var rules = struct {
+	sync.RWMutex
+	m     map[string]Rule
+	types map[reflect.Type]*structRules
+}{
+	m: map[string]Rule{
+		"min":   ruleMin,
+		"max":   ruleMax,
+		"len":   ruleLen,
+		"email": ruleEmail,
+		"oneof": ruleOneOf,
+	},
+	types: map[reflect.Type]*structRules{},
+}
+
+// measured are the built-in rules that measure numbers, or the length of
+// strings, slices and maps, whose parameter must be a number. It is guarded
+// by the lock of the rules.
+var measured = map[string]bool{"min": true, "max": true, "len": true}
+
+// RegisterRule registers a validation rule, replacing any rule with the
+// same name. The required and omitempty rules cannot be replaced.
+func RegisterRule(name string, rule Rule) {
+	rules.Lock()
+	rules.m[name] = rule
+	rules.types = map[reflect.Type]*structRules{}
+	delete(measured, name)
+	rules.Unlock()
+}
+
+// Validate validates the struct pointed to by v with the rules of the
+// validate struct tags, separated by commas:
+//
+//	type Signup struct {
+//		Name  string   `validate:"required,max=100"`
+//		Email string   `validate:"required,email"`
+//		Plan  string   `validate:"omitempty,oneof=free pro"`
+//		Seats int      `validate:"min=1,max=100"`
+//		Tags  []string `validate:"max=10"`
+//	}
+//
+// The built-in rules are required, omitempty (skip the remaining rules if
+// the value is empty), min, max and len (the value of numbers, or the length
+// of strings, slices and maps), email and oneof. Nested structs, and the
+// elements of slices of structs, are validated recursively.
+//
+// Fields are named by their json tag, or their form tag, as sent by the
+// clients, and otherwise by their Go name.
+//
+// All the failures are returned together in a ValidationError. The tags of
+// each struct type are parsed once, and an error is returned instead if they
+// name an unknown rule, or if the parameter of min, max or len is not a
+// number.
+func Validate(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	var errs ValidationError
+	if err := validateValue(rv, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidationError lists the fields that failed validation.
+type ValidationError []*Violation
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.Field + " " + v.Message
+	}
+	return "routes: validation failed: " + strings.Join(msgs, "; ")
+}
+
+// StatusCode returns 422 Unprocessable Entity.
+func (e ValidationError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// Violation describes a field that failed a validation rule.
+type Violation struct {
+	Field   string `json:"field" xml:"field"`                     // the path of the field, such as items[0].name
+	Rule    string `json:"rule" xml:"rule"`                       // the name of the rule
+	Param   string `json:"param,omitempty" xml:"param,omitempty"` // the parameter of the rule
+	Message string `json:"message" xml:"message"`                 // the reason the value is invalid
+}
+
+// validationBody is the body of the 422 response written by ServeInvalid.
+type validationBody struct {
+	XMLName xml.Name     `json:"-" xml:"error"`
+	Message string       `json:"message" xml:"message"`
+	Errors  []*Violation `json:"errors" xml:"errors>error"`
+}
+
+// ServeInvalid writes a 422 Unprocessable Entity response listing the
+// violations of the ValidationError, in the format negotiated with the
+// Accept header as ServeFormatted does:
+//
+//	{
+//	  "message": "Unprocessable Entity",
+//	  "errors": [
+//	    {"field": "Email", "rule": "email", "message": "must be a valid email address"}
+//	  ]
+//	}
+func ServeInvalid(w http.ResponseWriter, r *http.Request, err ValidationError) {
+	body := &validationBody{
+		Message: http.StatusText(http.StatusUnprocessableEntity),
+		Errors:  err,
+	}
+	serveFormatted(w, r, http.StatusUnprocessableEntity, body)
+}
+
+// structRules are the validation rules of the fields of a struct type.
+type structRules struct {
+	fields []fieldRules
+	err    error // the error of the validate tags, if any
+}
+
+// fieldRules are the validation rules of an exported struct field.
+type fieldRules struct {
+	index int
+	name  string
+	rules []fieldRule
+}
+
+// fieldRule is a rule of a validate tag.
+type fieldRule struct {
+	name  string
+	param string
+	rule  Rule // nil for the required and omitempty rules
+}
+
+// rulesOf returns the validation rules of the struct type, parsing its tags
+// the first time.
+func rulesOf(t reflect.Type) ([]fieldRules, error) {
+	rules.RLock()
+	s, ok := rules.types[t]
+	rules.RUnlock()
+	if ok {
+		return s.fields, s.err
+	}
+
+	rules.Lock()
+	defer rules.Unlock()
+	if s, ok = rules.types[t]; !ok {
+		s = parseRules(t)
+		rules.types[t] = s
+	}
+	return s.fields, s.err
+}
+
+// parseRules parses the validate tags of the struct type. The rules must be
+// locked by the caller.
+func parseRules(t reflect.Type) *structRules {
+	s := &structRules{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		f := fieldRules{index: i, name: fieldName(field)}
+		tag := field.Tag.Get("validate")
+		if tag == "-" {
+			tag = ""
+		}
+		for _, item := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(strings.TrimSpace(item), "=")
+			switch name {
+			case "":
+				continue
+			case "omitempty", "required":
+				f.rules = append(f.rules, fieldRule{name: name})
+				continue
+			}
+
+			rule, ok := rules.m[name]
+			if !ok {
+				s.err = fmt.Errorf("routes: unknown validation rule %q of field %s.%s", name, t, field.Name)
+				return s
+			}
+			if measured[name] {
+				if err := checkMeasured(field.Type, param); err != nil {
+					s.err = fmt.Errorf("routes: invalid validation rule %q of field %s.%s: %v", item, t, field.Name, err)
+					return s
+				}
+			}
+			f.rules = append(f.rules, fieldRule{name: name, param: param, rule: rule})
+		}
+		s.fields = append(s.fields, f)
+	}
+	return s
+}
+
+// fieldName returns the name of the field sent by the clients: the name of
+// its json tag, or its form tag, and otherwise its Go name.
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// validateValue validates the fields of structs, and the elements of slices
+// and arrays. The path is the path of the value within the validated value.
+func validateValue(v reflect.Value, path string, errs *ValidationError) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if isScalar(v) {
+			return nil
+		}
+		fields, err := rulesOf(v.Type())
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			fieldPath := field.name
+			if path != "" {
+				fieldPath = path + "." + field.name
+			}
+			validateField(v.Field(field.index), fieldPath, field.rules, errs)
+			if err := validateValue(v.Field(field.index), fieldPath, errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateField applies the rules of the tag to the field.
+func validateField(v reflect.Value, path string, rules []fieldRule, errs *ValidationError) {
+	for _, r := range rules {
+		switch r.name {
+		case "omitempty":
+			if isEmpty(v) {
+				return
+			}
+			continue
+		case "required":
+			if isEmpty(v) {
+				*errs = append(*errs, &Violation{Field: path, Rule: r.name, Message: "is required"})
+				return
+			}
+			continue
+		}
+
+		value := v
+		for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+			if value.IsNil() {
+				return
+			}
+			value = value.Elem()
+		}
+		if err := r.rule(value, r.param); err != nil {
+			*errs = append(*errs, &Violation{Field: path, Rule: r.name, Param: r.param, Message: err.Error()})
+		}
+	}
+}
+
+// isEmpty reports whether the value is a zero value, a nil pointer, or an
+// empty string, slice or map.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// Built-in Rules ---------------------------------------------------------------
+
+func ruleMin(v reflect.Value, param string) error {
+	n, isLen, ok := measure(v)
+	limit, _ := strconv.ParseFloat(param, 64)
+	switch {
+	case !ok:
+		return errNotMeasured
+	case n >= limit:
+		return nil
+	case isLen:
+		return fmt.Errorf("must have a length of at least %s", param)
+	}
+	return fmt.Errorf("must be at least %s", param)
+}
+
+func ruleMax(v reflect.Value, param string) error {
+	n, isLen, ok := measure(v)
+	limit, _ := strconv.ParseFloat(param, 64)
+	switch {
+	case !ok:
+		return errNotMeasured
+	case n <= limit:
+		return nil
+	case isLen:
+		return fmt.Errorf("must have a length of at most %s", param)
+	}
+	return fmt.Errorf("must be at most %s", param)
+}
+
+func ruleLen(v reflect.Value, param string) error {
+	n, _, ok := measure(v)
+	if !ok {
+		return errNotMeasured
+	}
+	if limit, _ := strconv.ParseFloat(param, 64); n != limit {
+		return fmt.Errorf("must have a length of %s", param)
+	}
+	return nil
+}
+
+// errNotMeasured is the error of the min, max and len rules for values
+// that are not a number, a string, a slice or a map, such as the value of
+// an interface field.
+var errNotMeasured = errors.New("must be a number, or a string, list or map")
+
+// checkMeasured checks that the parameter of the min, max or len rule is a
+// number, and that the values of the type can be measured.
+func checkMeasured(t reflect.Type, param string) error {
+	if _, err := strconv.ParseFloat(param, 64); err != nil {
+		return errors.New("the parameter must be a number")
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Interface && !measurable(t.Kind()) {
+		return fmt.Errorf("cannot measure the length of %s", t)
+	}
+	return nil
+}
+
+// measurable reports whether the values of the kind can be measured.
+func measurable(k reflect.Kind) bool {
+	switch k {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// measure returns the value of a number, or the length of a string, slice
+// or map, for the min, max and len rules, and whether it is a length. It
+// returns false if the value cannot be measured.
+func measure(v reflect.Value) (float64, bool, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true, true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	}
+	return 0, false, false
+}
+
+func ruleEmail(v reflect.Value, param string) error {
+	s := fmt.Sprint(v.Interface())
+	if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+		return errors.New("must be a valid email address")
+	}
+	return nil
+}
+
+func ruleOneOf(v reflect.Value, param string) error {
+	s := fmt.Sprint(v.Interface())
+	for _, option := range strings.Fields(param) {
+		if s == option {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(strings.Fields(param), ", "))
+}
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type validateItem struct {
+	SKU      string `validate:"required,len=6"`
+	Quantity int    `validate:"min=1,max=100"`
+}
+
+type validateOrder struct {
+	Email    string         `validate:"required,email"`
+	Plan     string         `validate:"omitempty,oneof=free pro"`
+	Note     *string        `validate:"max=5"`
+	Coupon   string         `validate:"omitempty,even"`
+	Items    []validateItem `validate:"min=1"`
+	Shipping *validateItem  `validate:"required"`
+	Gifts    []*validateItem
+}
+
+// TestValidate tests that the failures of each field are collected with the
+// path of the field, including nested structs and slices.
+func TestValidate(t *testing.T) {
+	RegisterRule("even", func(v reflect.Value, param string) error {
+		if v.Len()%2 != 0 {
+			return errors.New("must have an even length")
+		}
+		return nil
+	})
+
+	note := "too long"
+	order := &validateOrder{
+		Email:  "morpheus@",
+		Plan:   "enterprise",
+		Note:   &note,
+		Coupon: "abc",
+		Items:  []validateItem{{SKU: "ABC123", Quantity: 1}, {SKU: "ABC", Quantity: 0}},
+		Gifts:  []*validateItem{nil, {SKU: "XYZ789", Quantity: 101}},
+	}
+
+	err := Validate(order)
+	var errs ValidationError
+	if !errors.As(err, &errs) {
+		t.Fatalf("Validate returned [%v]; want a ValidationError", err)
+	}
+	if errs.StatusCode() != http.StatusUnprocessableEntity {
+		t.Errorf("StatusCode set to [%v]; want [%v]", errs.StatusCode(), http.StatusUnprocessableEntity)
+	}
+
+	want := []string{
+		"Email email",
+		"Plan oneof",
+		"Note max",
+		"Coupon even",
+		"Items[1].SKU len",
+		"Items[1].Quantity min",
+		"Shipping required",
+		"Gifts[1].Quantity max",
+	}
+	var got []string
+	for _, v := range errs {
+		got = append(got, v.Field+" "+v.Rule)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Violations set to %q; want %q", got, want)
+	}
+
+	valid := &validateOrder{
+		Email:    "morpheus@zion.io",
+		Items:    []validateItem{{SKU: "ABC123", Quantity: 1}},
+		Shipping: &validateItem{SKU: "ABC123", Quantity: 1},
+	}
+	if err := Validate(valid); err != nil {
+		t.Errorf("Validate returned [%v]; want nil", err)
+	}
+}
+
+// TestValidateNames tests that fields are named by their json or form tag.
+func TestValidateNames(t *testing.T) {
+	type address struct {
+		City string `json:"city,omitempty" validate:"required"`
+	}
+	type signup struct {
+		Name    string  `json:"-" form:"full_name" validate:"required"`
+		Address address `json:"address"`
+		Email   string  `validate:"required"`
+	}
+
+	err := Validate(&signup{})
+	var got []string
+	for _, v := range err.(ValidationError) {
+		got = append(got, v.Field)
+	}
+	want := []string{"full_name", "address.city", "Email"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Fields set to %q; want %q", got, want)
+	}
+}
+
+// TestValidateTags tests that invalid validate tags return an error, rather
+// than panic.
+func TestValidateTags(t *testing.T) {
+	tests := []interface{}{
+		&struct {
+			Name string `validate:"unknown"`
+		}{},
+		&struct {
+			Name string `validate:"min=abc"`
+		}{},
+		&struct {
+			Done bool `validate:"max=1"`
+		}{},
+	}
+
+	for _, v := range tests {
+		for i := 0; i < 2; i++ {
+			err := Validate(v)
+			if _, ok := err.(ValidationError); err == nil || ok {
+				t.Errorf("Validate %T returned [%v]; want a tag error", v, err)
+			}
+		}
+	}
+}
+
+// TestServeInvalid tests that the 422 response lists the violations.
+func TestServeInvalid(t *testing.T) {
+	err := Validate(&validateItem{Quantity: 1})
+
+	r, _ := http.NewRequest("POST", "/", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	ServeInvalid(w, r, err.(ValidationError))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Code set to [%v]; want [%v]", w.Code, http.StatusUnprocessableEntity)
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type set to [%s]; want [%s]", w.Header().Get("Content-Type"), "application/json")
+	}
+
+	var body struct {
+		Message string
+		Errors  []Violation
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if len(body.Errors) != 1 || body.Errors[0].Field != "SKU" || body.Errors[0].Message != "is required" {
+		t.Errorf("Body set to [%s]; want the SKU violation", w.Body.String())
+	}
+}
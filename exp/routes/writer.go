@@ -2,17 +2,77 @@ package routes
 
 import (
 	"bufio"
+	"io"
 	"net"
 	"net/http"
+	"time"
 )
 
+// ResponseInfo is a read-only view of the response recorded by the Router.
+// It allows middleware, such as logging, metrics or tracing, to inspect the
+// response without wrapping the http.ResponseWriter again.
+type ResponseInfo interface {
+	// Status returns the status code written to the response, or 0 if
+	// nothing has been written yet. A response written without calling
+	// WriteHeader reports 200 OK.
+	Status() int
+
+	// BytesWritten returns the number of bytes written to the response body.
+	BytesWritten() int64
+
+	// Start returns the time the Router started handling the request.
+	Start() time.Time
+
+	// TimeToFirstByte returns the time elapsed between the start of the
+	// request and the first write to the response, or 0 if nothing has
+	// been written yet.
+	TimeToFirstByte() time.Duration
+
+	// Pattern returns the route pattern matched by the request, or an empty
+	// string if no route was matched.
+	Pattern() string
+}
+
+// Response returns the ResponseInfo recorded by the Router for the given
+// http.ResponseWriter. Writers that wrap the Router's writer are unwrapped
+// using their Unwrap method.
+func Response(w http.ResponseWriter) (ResponseInfo, bool) {
+	if rw := unwrap(w); rw != nil {
+		return rw, true
+	}
+	return nil, false
+}
+
+// unwrap returns the Router's responseWriter, unwrapping any writers that
+// wrap it, or nil if the http.ResponseWriter was not created by the Router.
+func unwrap(w http.ResponseWriter) *responseWriter {
+	for {
+		switch v := w.(type) {
+		case *responseWriter:
+			return v
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
 // ResponseWriter is a wrapper for the http.ResponseWriter to track if
 // response was written to.
 type responseWriter struct {
 	Router  *Router
 	writer  http.ResponseWriter
+	req     *http.Request
 	started bool
 	status  int
+	pattern string
+	span    Span
+	timing  *serverTiming
+	failing bool      // the ErrorFunc of the Router is rendering an error
+	written int64     // number of bytes written to the body
+	start   time.Time // time the request was started
+	first   time.Time // time of the first write to the response
 }
 
 // Header returns the header map that will be sent by WriteHeader.
@@ -23,20 +83,125 @@ func (w *responseWriter) Header() http.Header {
 // Write writes the data to the connection as part of an HTTP reply,
 // and sets `started` to true
 func (w *responseWriter) Write(p []byte) (int, error) {
-	w.started = true
-	return w.writer.Write(p)
+	w.begin(http.StatusOK)
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
 }
 
 // WriteHeader sends an HTTP response header with status code,
 // and sets `started` to true
 func (w *responseWriter) WriteHeader(code int) {
-	w.status = code
-	w.started = true
+	w.begin(code)
 	w.writer.WriteHeader(code)
 }
 
+// begin records the status code and time of the first write to the
+// response, adds the Server-Timing header if enabled, and sets `started`
+// to true
+func (w *responseWriter) begin(code int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.status = code
+	w.first = time.Now()
+	if w.timing != nil {
+		w.Header().Set("Server-Timing", w.timing.header())
+	}
+}
+
+// Status returns the status code written to the response.
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the number of bytes written to the response body.
+func (w *responseWriter) BytesWritten() int64 {
+	return w.written
+}
+
+// Start returns the time the request was started.
+func (w *responseWriter) Start() time.Time {
+	return w.start
+}
+
+// TimeToFirstByte returns the time elapsed between the start of the request
+// and the first write to the response.
+func (w *responseWriter) TimeToFirstByte() time.Duration {
+	if w.first.IsZero() {
+		return 0
+	}
+	return w.first.Sub(w.start)
+}
+
+// Pattern returns the route pattern matched by the request.
+func (w *responseWriter) Pattern() string {
+	return w.pattern
+}
+
+// Flush sends any buffered data to the client, if supported by the
+// underlying http.ResponseWriter.
+func (w *responseWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError sends any buffered data to the client, and returns an error
+// if the underlying http.ResponseWriter does not support flushing.
+func (w *responseWriter) FlushError() error {
+	switch f := w.writer.(type) {
+	case interface{ FlushError() error }:
+		w.begin(http.StatusOK)
+		return f.FlushError()
+	case http.Flusher:
+		w.begin(http.StatusOK)
+		f.Flush()
+		return nil
+	}
+	return http.ErrNotSupported
+}
+
+// Push initiates an HTTP/2 server push, if supported by the underlying
+// http.ResponseWriter.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.writer.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// ReadFrom reads data from src until EOF and writes it to the connection,
+// using the underlying io.ReaderFrom if available to enable zero-copy sends.
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.begin(http.StatusOK)
+	var n int64
+	var err error
+	if rf, ok := w.writer.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(w.writer, src)
+	}
+	w.written += n
+	return n, err
+}
+
 // The Hijacker interface is implemented by ResponseWriters that allow an
-// HTTP handler to take over the connection.
+// HTTP handler to take over the connection. An error is returned if the
+// underlying http.ResponseWriter does not support hijacking.
 func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	return w.writer.(http.Hijacker).Hijack()
+	h, ok := w.writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.started = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter, which allows the
+// http.ResponseController to access its optional interfaces.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.writer
 }
@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestWriterInterfaces tests that the responseWriter forwards the optional
+// interfaces of the underlying http.ResponseWriter.
+func TestWriterInterfaces(t *testing.T) {
+	mux := NewRouter()
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if err := rc.Flush(); err != nil {
+			t.Errorf("Flush returned error [%v]; want nil", err)
+		}
+		if _, _, err := rc.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+			t.Errorf("Hijack returned error [%v]; want [%v]", err, http.ErrNotSupported)
+		}
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Errorf("ResponseWriter does not implement io.ReaderFrom")
+		}
+		io.Copy(w, strings.NewReader("hello world"))
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if !w.Flushed {
+		t.Errorf("ResponseWriter was not flushed")
+	}
+	if w.Body.String() != "hello world" {
+		t.Errorf("Body set to [%s]; want [%s]", w.Body.String(), "hello world")
+	}
+}
+
+// TestResponseInfo tests that the response status, size and route pattern
+// are recorded, and accessible to the after filters.
+func TestResponseInfo(t *testing.T) {
+	mux := NewRouter()
+	var info ResponseInfo
+	mux.After(func(w http.ResponseWriter, r *http.Request, status int) {
+		info, _ = Response(w)
+	})
+	mux.Get("/person/:last/:first", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello world")
+	})
+
+	r, _ := http.NewRequest("GET", "/person/anderson/thomas", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if info == nil {
+		t.Fatalf("ResponseInfo not found for the ResponseWriter")
+	}
+	if info.Status() != http.StatusOK {
+		t.Errorf("Status set to [%v]; want [%v]", info.Status(), http.StatusOK)
+	}
+	if info.BytesWritten() != 11 {
+		t.Errorf("BytesWritten set to [%v]; want [%v]", info.BytesWritten(), 11)
+	}
+	if info.Pattern() != "/person/:last/:first" {
+		t.Errorf("Pattern set to [%s]; want [%s]", info.Pattern(), "/person/:last/:first")
+	}
+}
@@ -0,0 +1,224 @@
+// Package header parses the HTTP request headers used for content
+// negotiation. It is shared by the routers of this module.
+package header
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Negotiate returns the media type from the list of offers that best
+// matches the Accept header values, as defined by RFC 9110. The offer with
+// the highest quality value is returned, and ties are resolved in the order
+// of the offers. Each offer is weighted by the most specific media range
+// that matches it, so that "text/*;q=0.5, text/html" prefers text/html over
+// text/plain.
+//
+// If there is no Accept header, or it is empty, the first offer is
+// returned. If none of the offers is acceptable an empty string is
+// returned.
+func Negotiate(accept []string, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(strings.Join(accept, "")) == "" {
+		return offers[0]
+	}
+
+	ranges := parseAccept(accept)
+	best, bestq := "", 0.0
+	for _, offer := range offers {
+		typ, params := ParseMediaType(offer)
+		if q := quality(ranges, typ, params); q > bestq {
+			best, bestq = offer, q
+		}
+	}
+	return best
+}
+
+// mediaRange is a media range of the Accept header.
+type mediaRange struct {
+	typ    string            // the type, such as text
+	sub    string            // the subtype, such as html
+	params map[string]string // the media type parameters, excluding q
+	q      float64           // the quality value
+}
+
+// parseAccept parses the media ranges of the Accept header values. Invalid
+// media ranges are ignored.
+func parseAccept(values []string) []mediaRange {
+	var ranges []mediaRange
+	for _, value := range values {
+		for _, item := range SplitQuoted(value, ',') {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			typ, params := ParseMediaType(item)
+			slash := strings.IndexByte(typ, '/')
+			if slash <= 0 || slash == len(typ)-1 {
+				continue
+			}
+			mr := mediaRange{typ: typ[:slash], sub: typ[slash+1:], params: params, q: 1}
+			if mr.typ == "*" && mr.sub != "*" {
+				continue
+			}
+			if v, ok := params["q"]; ok {
+				q, err := strconv.ParseFloat(v, 64)
+				if err != nil || q < 0 || q > 1 {
+					continue
+				}
+				mr.q = q
+				delete(params, "q")
+			}
+			ranges = append(ranges, mr)
+		}
+	}
+	return ranges
+}
+
+// ParseMediaType splits a media type into the lowercase type and subtype,
+// and its parameters. Parameter names are lowercase, and the values are
+// unquoted.
+func ParseMediaType(s string) (string, map[string]string) {
+	parts := SplitQuoted(s, ';')
+	typ := strings.ToLower(strings.TrimSpace(parts[0]))
+	params := make(map[string]string)
+	for _, part := range parts[1:] {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		params[key] = Unquote(strings.TrimSpace(val))
+	}
+	return typ, params
+}
+
+// quality returns the quality value of the media type, given by the most
+// specific media range that matches it. It returns 0 if no media range
+// matches.
+func quality(ranges []mediaRange, typ string, params map[string]string) float64 {
+	slash := strings.IndexByte(typ, '/')
+	if slash < 0 {
+		return 0
+	}
+	main, sub := typ[:slash], typ[slash+1:]
+
+	q, specificity := 0.0, -1
+	for _, mr := range ranges {
+		s := mr.match(main, sub, params)
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+	return q
+}
+
+// match returns the specificity of the media range if it matches the media
+// type, or -1 if it does not. An exact match is more specific than a
+// subtype wildcard, which is more specific than */*, and each matching
+// parameter adds to the specificity. Parameters of the media range that the
+// media type does not specify, such as a charset, are ignored.
+func (mr mediaRange) match(typ, sub string, params map[string]string) int {
+	var s int
+	switch {
+	case mr.typ == "*" && mr.sub == "*":
+		s = 0
+	case mr.typ == typ && mr.sub == "*":
+		s = 1
+	case mr.typ == typ && mr.sub == sub:
+		s = 2
+	default:
+		return -1
+	}
+
+	var n int
+	for key, val := range mr.params {
+		v, ok := params[key]
+		if !ok {
+			continue
+		}
+		if !strings.EqualFold(v, val) {
+			return -1
+		}
+		n++
+	}
+	return s*16 + n
+}
+
+// ParseAcceptEncoding returns the quality values of the content codings of
+// the Accept-Encoding header values. Invalid quality values are ignored.
+func ParseAcceptEncoding(values []string) map[string]float64 {
+	qs := make(map[string]float64)
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(item, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding == "" {
+				continue
+			}
+			q := 1.0
+			if key, val, ok := strings.Cut(params, "="); ok && strings.TrimSpace(key) == "q" {
+				var err error
+				if q, err = strconv.ParseFloat(strings.TrimSpace(val), 64); err != nil || q < 0 || q > 1 {
+					continue
+				}
+			}
+			qs[coding] = q
+		}
+	}
+	return qs
+}
+
+// EncodingQuality returns the quality value of the content coding, or of
+// the wildcard if the coding is not listed.
+func EncodingQuality(qs map[string]float64, coding string) float64 {
+	if q, ok := qs[coding]; ok {
+		return q
+	}
+	if coding == "gzip" {
+		if q, ok := qs["x-gzip"]; ok {
+			return q
+		}
+	}
+	return qs["*"]
+}
+
+// SplitQuoted splits s by the separator, ignoring separators that appear
+// inside quoted strings.
+func SplitQuoted(s string, sep byte) []string {
+	var parts []string
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\' && quoted:
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Unquote removes the quotes from a quoted string, and unescapes any quoted
+// pairs.
+func Unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package header
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitQuoted(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"a,b", []string{"a", "b"}},
+		{`a="x,y",b`, []string{`a="x,y"`, "b"}},
+		{`a="x\",y",b`, []string{`a="x\",y"`, "b"}},
+		{"", []string{""}},
+	}
+
+	for _, test := range tests {
+		if got := SplitQuoted(test.s, ','); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SplitQuoted [%s] set to [%q]; want [%q]", test.s, got, test.want)
+		}
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"utf-8", "utf-8"},
+		{`"utf-8"`, "utf-8"},
+		{`"a\"b"`, `a"b`},
+		{`"`, `"`},
+	}
+
+	for _, test := range tests {
+		if got := Unquote(test.s); got != test.want {
+			t.Errorf("Unquote [%s] set to [%s]; want [%s]", test.s, got, test.want)
+		}
+	}
+}
+
+func TestEncodingQuality(t *testing.T) {
+	tests := []struct {
+		accept string
+		coding string
+		want   float64
+	}{
+		{"gzip, br", "br", 1},
+		{"gzip;q=0.5", "gzip", 0.5},
+		{"x-gzip;q=0.4", "gzip", 0.4},
+		{"*;q=0.3", "br", 0.3},
+		{"br;q=0, *", "br", 0},
+		{"gzip;q=2", "gzip", 0},
+		{"", "gzip", 0},
+	}
+
+	for _, test := range tests {
+		qs := ParseAcceptEncoding([]string{test.accept})
+		if got := EncodingQuality(qs, test.coding); got != test.want {
+			t.Errorf("EncodingQuality [%s] [%s] set to [%v]; want [%v]", test.accept, test.coding, got, test.want)
+		}
+	}
+}
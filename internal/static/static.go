@@ -0,0 +1,395 @@
+// Package static serves the files of a file system under a path prefix. It
+// implements the StaticFS method of the routers of this module, which wrap
+// it with their own options and error handling.
+//
+// DirFS opens the directory with os.OpenRoot, so the package requires Go
+// 1.24 or later.
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/drone/routes/internal/header"
+)
+
+// Options configure how the files are served. They are documented by the
+// StaticOptions of the routers.
+type Options struct {
+	Index         []string
+	Browse        bool
+	Hidden        bool
+	SPA           bool
+	Precompressed bool
+	CacheControl  []CachePolicy
+	Fingerprint   bool
+}
+
+// Cache-Control values for common policies.
+const (
+	CacheImmutable = "public, max-age=31536000, immutable" // fingerprinted files that never change
+	CacheNoCache   = "no-cache"                            // files that must be revalidated
+)
+
+// CachePolicy sets the Cache-Control header of the files that match a
+// pattern.
+type CachePolicy struct {
+	// Pattern matches the path of the file, relative to the root, with the
+	// syntax of path.Match. A pattern without a slash matches the name of
+	// the file in any directory, such as *.html.
+	Pattern string
+
+	// Value is the Cache-Control header value.
+	Value string
+}
+
+// match reports whether the policy applies to the file.
+func (p CachePolicy) match(name string) bool {
+	if !strings.Contains(p.Pattern, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(p.Pattern, name)
+	return ok
+}
+
+// Server serves the files of a file system under a path prefix.
+type Server struct {
+	fsys         fs.FS
+	prefix       string
+	opts         Options
+	error        func(w http.ResponseWriter, r *http.Request, code int)
+	manifest     map[string]string // the fingerprinted names of the files
+	fingerprints map[string]string // the files, by fingerprinted name
+}
+
+// New returns a Server for the files of the file system under the path
+// prefix, which renders errors with the error function. The prefix is
+// matched literally, so it returns an error if the prefix contains a
+// parameter. If the files are fingerprinted, it also returns an error if
+// they cannot be listed or read.
+func New(prefix string, fsys fs.FS, opts Options, error func(w http.ResponseWriter, r *http.Request, code int)) (*Server, error) {
+	if strings.Contains(prefix, ":") {
+		return nil, fmt.Errorf("routes: static prefix %q must not contain parameters", prefix)
+	}
+	s := &Server{
+		fsys:   fsys,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		opts:   opts,
+		error:  error,
+	}
+	if opts.Fingerprint {
+		if err := s.fingerprint(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Pattern returns the route pattern that matches the prefix, and the paths
+// under it. The prefix is quoted, so that a prefix such as /v1.0 does not
+// match /v1x0.
+func (s *Server) Pattern() string {
+	return regexp.QuoteMeta(s.prefix) + "(/.*)?"
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upath := strings.TrimPrefix(r.URL.Path, s.prefix)
+	if upath == "" {
+		redirect(w, r, path.Base(r.URL.Path)+"/")
+		return
+	}
+	name := strings.TrimPrefix(path.Clean(upath), "/")
+	if name == "" {
+		name = "."
+	}
+	if !s.opts.Hidden && isHidden(name) {
+		s.error(w, r, http.StatusNotFound)
+		return
+	}
+	immutable := false
+	if file, ok := s.fingerprints[name]; ok {
+		name, immutable = file, true
+	}
+
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		if s.opts.SPA && path.Ext(name) == "" && errors.Is(err, fs.ErrNotExist) {
+			s.serveIndex(w, r, ".")
+			return
+		}
+		s.fail(w, r, err)
+		return
+	}
+
+	if !info.IsDir() {
+		s.serveFile(w, r, name, info, immutable)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		redirect(w, r, path.Base(r.URL.Path)+"/")
+		return
+	}
+	s.serveIndex(w, r, name)
+}
+
+// serveIndex serves the index file of the directory, or its listing if
+// enabled.
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request, dir string) {
+	index := s.opts.Index
+	if len(index) == 0 {
+		index = []string{"index.html"}
+	}
+	for _, file := range index {
+		name := path.Join(dir, file)
+		if info, err := fs.Stat(s.fsys, name); err == nil && !info.IsDir() {
+			s.serveFile(w, r, name, info, false)
+			return
+		}
+	}
+	if s.opts.Browse {
+		s.serveDir(w, r, dir)
+		return
+	}
+	s.error(w, r, http.StatusNotFound)
+}
+
+// serveFile serves the file, or its precompressed sibling if enabled,
+// handling range and conditional requests. Fingerprinted files are
+// immutable.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, name string, info fs.FileInfo, immutable bool) {
+	file, encoding := name, ""
+	if s.opts.Precompressed {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if sibling, enc, fi := s.precompressed(r, name); sibling != "" {
+			file, encoding, info = sibling, enc, fi
+		}
+	}
+
+	f, err := s.fsys.Open(file)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	h := w.Header()
+	if encoding != "" {
+		// the type of the content is given by the original file, rather
+		// than sniffed from the compressed data
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		h.Set("Content-Type", ctype)
+		h.Set("Content-Encoding", encoding)
+	}
+	for _, policy := range s.opts.CacheControl {
+		if policy.match(name) {
+			h.Set("Cache-Control", policy.Value)
+			break
+		}
+	}
+	if immutable {
+		h.Set("Cache-Control", CacheImmutable)
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			s.fail(w, r, err)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
+
+// precompressedFiles are the extensions of precompressed files, by encoding,
+// in order of preference.
+var precompressedFiles = []struct{ encoding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// precompressed returns the name, encoding and info of the precompressed
+// sibling of the file that best matches the Accept-Encoding header, or an
+// empty name if there is none.
+func (s *Server) precompressed(r *http.Request, name string) (string, string, fs.FileInfo) {
+	qs := header.ParseAcceptEncoding(r.Header.Values("Accept-Encoding"))
+	sibling, encoding, bestq := "", "", 0.0
+	var info fs.FileInfo
+	for _, p := range precompressedFiles {
+		q := header.EncodingQuality(qs, p.encoding)
+		if q <= bestq {
+			continue
+		}
+		fi, err := fs.Stat(s.fsys, name+p.ext)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		sibling, encoding, bestq, info = name+p.ext, p.encoding, q, fi
+	}
+	return sibling, encoding, info
+}
+
+// serveDir writes the listing of the directory.
+func (s *Server) serveDir(w http.ResponseWriter, r *http.Request, dir string) {
+	entries, err := fs.ReadDir(s.fsys, dir)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		name := entry.Name()
+		if !s.opts.Hidden && isHidden(name) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(&buf, "<a href=\"%s\">%s</a>\n", html.EscapeString(link.String()), html.EscapeString(name))
+	}
+	buf.WriteString("</pre>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// fail renders the error of the file system as 403 Forbidden for
+// permission errors, and 404 Not Found otherwise, including for paths that
+// escape the root through a symbolic link.
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, fs.ErrPermission) {
+		s.error(w, r, http.StatusForbidden)
+		return
+	}
+	s.error(w, r, http.StatusNotFound)
+}
+
+// Asset returns the fingerprinted URL of a file, given its name relative to
+// the root of the file system, or its URL path. It returns false if the
+// file is not fingerprinted.
+func (s *Server) Asset(name string) (string, bool) {
+	file := name
+	if strings.HasPrefix(name, "/") {
+		if !strings.HasPrefix(name, s.prefix+"/") {
+			return "", false
+		}
+		file = strings.TrimPrefix(name, s.prefix+"/")
+	}
+	hashed, ok := s.manifest[file]
+	if !ok {
+		return "", false
+	}
+	return s.prefix + "/" + hashed, true
+}
+
+// fingerprint hashes the files, and records their fingerprinted names.
+// Hidden files are skipped unless enabled, as are the symbolic links that
+// cannot be followed, such as links outside of the root, and the links to
+// directories. It returns an error if a file cannot be read.
+func (s *Server) fingerprint() error {
+	s.manifest = make(map[string]string)
+	s.fingerprints = make(map[string]string)
+	return fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !s.opts.Hidden && isHidden(name) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			info, err := fs.Stat(s.fsys, name)
+			switch {
+			case errors.Is(err, fs.ErrPermission):
+				return err
+			case err != nil, info.IsDir():
+				return nil
+			}
+		}
+		hash, err := hashFile(s.fsys, name)
+		if err != nil {
+			return err
+		}
+		hashed := fingerprintName(name, hash)
+		s.manifest[name] = hashed
+		s.fingerprints[hashed] = name
+		return nil
+	})
+}
+
+// hashFile returns the hex encoded prefix of the SHA-256 hash of the file.
+func hashFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)[:4]), nil
+}
+
+// fingerprintName inserts the hash in the name of the file, before its
+// extension, such as css/site.3f9a2c1b.css.
+func fingerprintName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// isHidden reports whether an element of the path starts with a dot.
+func isHidden(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if len(elem) > 1 && elem[0] == '.' {
+			return true
+		}
+	}
+	return false
+}
+
+// DirFS returns the file system of the directory, which refuses to open the
+// files outside of it, even through symbolic links. It returns an error if
+// the directory cannot be opened.
+func DirFS(dir string) (fs.FS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return root.FS(), nil
+}
+
+// redirect redirects the request to the relative path, keeping the query.
+func redirect(w http.ResponseWriter, r *http.Request, target string) {
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
@@ -0,0 +1,124 @@
+package static
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCachePolicy(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.html", "index.html", true},
+		{"*.html", "docs/index.html", true},
+		{"assets/*", "assets/app.js", true},
+		{"assets/*", "lib/assets/app.js", false},
+		{"*.css", "app.js", false},
+	}
+
+	for _, test := range tests {
+		p := CachePolicy{Pattern: test.pattern}
+		if got := p.match(test.name); got != test.want {
+			t.Errorf("CachePolicy [%s] match [%s] set to [%v]; want [%v]", test.pattern, test.name, got, test.want)
+		}
+	}
+}
+
+// TestPattern tests that the prefix is matched literally, and that a
+// prefix with a parameter is rejected.
+func TestPattern(t *testing.T) {
+	s, err := New("/v1.0/", fstest.MapFS{}, Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile("^" + s.Pattern() + "$")
+	for path, want := range map[string]bool{"/v1.0": true, "/v1.0/a.txt": true, "/v1x0/a.txt": false} {
+		if got := re.MatchString(path); got != want {
+			t.Errorf("Pattern [%s] match [%s] set to [%v]; want [%v]", s.Pattern(), path, got, want)
+		}
+	}
+
+	if _, err := New("/users/:id", fstest.MapFS{}, Options{}, nil); err == nil {
+		t.Errorf("New with a parameter in the prefix returned nil; want an error")
+	}
+}
+
+func TestAsset(t *testing.T) {
+	fsys := fstest.MapFS{
+		"css/site.css": {Data: []byte("body{}")},
+		".env":         {Data: []byte("SECRET=1")},
+	}
+	s, err := New("/static/", fsys, Options{Fingerprint: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, ok := s.Asset("css/site.css")
+	if !ok {
+		t.Fatalf("Asset [css/site.css] not found")
+	}
+	if got, _ := s.Asset("/static/css/site.css"); got != url {
+		t.Errorf("Asset [/static/css/site.css] set to [%s]; want [%s]", got, url)
+	}
+	if _, ok := s.Asset("/other/css/site.css"); ok {
+		t.Errorf("Asset [/other/css/site.css] found; want not found")
+	}
+	if _, ok := s.Asset(".env"); ok {
+		t.Errorf("Asset [.env] found; want hidden files skipped")
+	}
+}
+
+// TestFingerprintLinks tests that the links outside of the root are skipped
+// when the files are fingerprinted, rather than failing.
+func TestFingerprintLinks(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "public")
+	os.MkdirAll(filepath.Join(root, "css"), 0755)
+	os.WriteFile(filepath.Join(base, "secret.txt"), []byte("secret"), 0644)
+	os.WriteFile(filepath.Join(root, "app.js"), []byte("app"), 0644)
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(root, "leak.txt")); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+	os.Symlink("app.js", filepath.Join(root, "alias.js"))
+	os.Symlink("css", filepath.Join(root, "styles"))
+
+	fsys, err := DirFS(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New("/static", fsys, Options{Fingerprint: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"app.js": true, "alias.js": true, "leak.txt": false, "styles": false} {
+		if _, ok := s.Asset(name); ok != want {
+			t.Errorf("Asset [%s] found set to [%v]; want [%v]", name, ok, want)
+		}
+	}
+}
+
+// TestFingerprintError tests that the files that cannot be read are
+// reported when the files are fingerprinted.
+func TestFingerprintError(t *testing.T) {
+	fsys := errorFS{fstest.MapFS{"app.js": {Data: []byte("app")}}}
+	if _, err := New("/static", fsys, Options{Fingerprint: true}, nil); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("New error set to [%v]; want [%v]", err, fs.ErrPermission)
+	}
+}
+
+// errorFS is a file system whose files cannot be opened.
+type errorFS struct{ fstest.MapFS }
+
+func (f errorFS) Open(name string) (fs.File, error) {
+	if name == "." {
+		return f.MapFS.Open(name)
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+}
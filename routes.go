@@ -1,15 +1,25 @@
 package routes
 
 import (
+	"bufio"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
-	"path/filepath"
 	"regexp"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/drone/routes/internal/header"
+	"github.com/drone/routes/internal/static"
 )
 
 const (
@@ -31,16 +41,68 @@ const (
 	textXml         = "text/xml"
 )
 
-type route struct {
+// Route is a handle to a route registered with the RouteMux. It is used
+// to attach middleware filters that only apply to this route.
+type Route struct {
 	method  string
+	pattern string
 	regex   *regexp.Regexp
 	params  map[int]string
 	handler http.HandlerFunc
+	filters []http.HandlerFunc
+}
+
+// With adds middleware filters that are only executed for this Route. Route
+// filters run after the RouteMux filters, and before the request handler.
+func (r *Route) With(filters ...http.HandlerFunc) *Route {
+	r.filters = append(r.filters, filters...)
+	return r
+}
+
+// AfterFunc is a middleware filter that is executed after the request
+// has been handled, with the status code written to the response.
+type AfterFunc func(w http.ResponseWriter, r *http.Request, status int)
+
+// ErrorFunc renders an error response with the given status code. It is
+// used by the RouteMux for the responses it generates, such as 404 Not Found
+// or 500 Internal Server Error.
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, code int)
+
+// Panic describes a panic recovered while serving a request.
+type Panic struct {
+	Value   interface{} // the value passed to panic
+	Stack   []byte      // the stack trace of the goroutine
+	Pattern string      // the route pattern matched by the request
+}
+
+// PanicFunc is a hook that is invoked when a panic is recovered, for
+// example to report the panic to an error tracker.
+type PanicFunc func(r *http.Request, p *Panic)
+
+// HandlerErrorFunc is a hook that is invoked with the errors returned by the
+// handlers adapted with Handle, for example to report the errors.
+type HandlerErrorFunc func(r *http.Request, err error)
+
+// StatusCoder is implemented by errors that map to an HTTP status code, for
+// example a not found error that maps to 404 Not Found.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// errorMapping maps the errors matching target to a status code.
+type errorMapping struct {
+	target error
+	code   int
 }
 
 type RouteMux struct {
-	routes  []*route
-	filters []http.HandlerFunc
+	routes   []*Route
+	filters  []http.HandlerFunc
+	after    []AfterFunc
+	errors   ErrorFunc
+	panics   []PanicFunc
+	mappings []errorMapping
+	hooks    []HandlerErrorFunc
 }
 
 func New() *RouteMux {
@@ -48,45 +110,146 @@ func New() *RouteMux {
 }
 
 // Get adds a new Route for GET requests.
-func (m *RouteMux) Get(pattern string, handler http.HandlerFunc) {
-	m.AddRoute(GET, pattern, handler)
+func (m *RouteMux) Get(pattern string, handler http.HandlerFunc) *Route {
+	return m.AddRoute(GET, pattern, handler)
 }
 
 // Put adds a new Route for PUT requests.
-func (m *RouteMux) Put(pattern string, handler http.HandlerFunc) {
-	m.AddRoute(PUT, pattern, handler)
+func (m *RouteMux) Put(pattern string, handler http.HandlerFunc) *Route {
+	return m.AddRoute(PUT, pattern, handler)
 }
 
 // Del adds a new Route for DELETE requests.
-func (m *RouteMux) Del(pattern string, handler http.HandlerFunc) {
-	m.AddRoute(DELETE, pattern, handler)
+func (m *RouteMux) Del(pattern string, handler http.HandlerFunc) *Route {
+	return m.AddRoute(DELETE, pattern, handler)
 }
 
 // Patch adds a new Route for PATCH requests.
-func (m *RouteMux) Patch(pattern string, handler http.HandlerFunc) {
-	m.AddRoute(PATCH, pattern, handler)
+func (m *RouteMux) Patch(pattern string, handler http.HandlerFunc) *Route {
+	return m.AddRoute(PATCH, pattern, handler)
 }
 
 // Post adds a new Route for POST requests.
-func (m *RouteMux) Post(pattern string, handler http.HandlerFunc) {
-	m.AddRoute(POST, pattern, handler)
-}
-
-// Adds a new Route for Static http requests. Serves
-// static files from the specified directory
-func (m *RouteMux) Static(pattern string, dir string) {
-	//append a regex to the param to match everything
-	// that comes after the prefix
-	pattern = pattern + "(.+)"
-	m.AddRoute(GET, pattern, func(w http.ResponseWriter, r *http.Request) {
-		path := filepath.Clean(r.URL.Path)
-		path = filepath.Join(dir, path)
-		http.ServeFile(w, r, path)
-	})
+func (m *RouteMux) Post(pattern string, handler http.HandlerFunc) *Route {
+	return m.AddRoute(POST, pattern, handler)
+}
+
+// StaticOptions configure how StaticFS serves files.
+type StaticOptions struct {
+	// Index are the names of the files served for a directory, in order of
+	// preference. If empty, index.html is served.
+	Index []string
+
+	// Browse enables the listing of directories without an index file.
+	// Otherwise they are not found.
+	Browse bool
+
+	// Hidden enables serving the files and directories whose name starts
+	// with a dot, such as .well-known. Otherwise they are not found, so that
+	// files such as .env or .git/config are never served.
+	Hidden bool
+
+	// SPA enables the fallback of single-page applications: requests for
+	// files that do not exist, and whose name has no extension, are served
+	// the index file of the root directory, so that the application can
+	// handle its own routes. Requests for missing assets, such as /app.js,
+	// are still not found.
+	SPA bool
+
+	// Precompressed enables serving the precompressed siblings of files,
+	// such as app.js.br or app.js.gz, to the clients that accept their
+	// encoding.
+	Precompressed bool
+
+	// CacheControl are the Cache-Control policies of the files. The first
+	// policy that matches the path of a file is applied.
+	CacheControl []CachePolicy
+}
+
+// Cache-Control values for common policies.
+const (
+	CacheImmutable = static.CacheImmutable // fingerprinted files that never change
+	CacheNoCache   = static.CacheNoCache   // files that must be revalidated
+)
+
+// CachePolicy sets the Cache-Control header of the static files that match
+// a pattern, for example:
+//
+//	[]routes.CachePolicy{
+//		{Pattern: "index.html", Value: routes.CacheNoCache},
+//		{Pattern: "assets/*", Value: routes.CacheImmutable},
+//	}
+type CachePolicy struct {
+	// Pattern matches the path of the file, relative to the root, with the
+	// syntax of path.Match. A pattern without a slash matches the name of
+	// the file in any directory, such as *.html.
+	Pattern string
+
+	// Value is the Cache-Control header value.
+	Value string
+}
+
+// options returns the options of the static file server.
+func (opts *StaticOptions) options() static.Options {
+	o := static.Options{
+		Index:         opts.Index,
+		Browse:        opts.Browse,
+		Hidden:        opts.Hidden,
+		SPA:           opts.SPA,
+		Precompressed: opts.Precompressed,
+	}
+	for _, policy := range opts.CacheControl {
+		o.CacheControl = append(o.CacheControl, static.CachePolicy(policy))
+	}
+	return o
+}
+
+// Static adds a new Route for GET requests that serves the files of the
+// directory under the path prefix, as StaticDir does with the default
+// options.
+func (m *RouteMux) Static(pattern string, dir string) *Route {
+	return m.StaticDir(pattern, dir, nil)
+}
+
+// StaticDir adds a new Route for GET requests that serves the files of the
+// directory under the path prefix, as StaticFS does. Files outside of the
+// directory are never served, even through symbolic links, and links with
+// an absolute target are refused, unlike the files of os.DirFS. It panics
+// if the directory cannot be opened.
+func (m *RouteMux) StaticDir(pattern string, dir string, opts *StaticOptions) *Route {
+	fsys, err := static.DirFS(dir)
+	if err != nil {
+		panic(err)
+	}
+	return m.StaticFS(pattern, fsys, opts)
+}
+
+// StaticFS adds a new Route for GET requests that serves the files of the
+// file system under the path prefix, for example the files embedded in the
+// binary:
+//
+//	//go:embed dist
+//	var dist embed.FS
+//
+//	assets, _ := fs.Sub(dist, "dist")
+//	mux.StaticFS("/app", assets, &routes.StaticOptions{SPA: true})
+//
+// A request for /app/css/site.css is served the file css/site.css. If opts
+// is nil, the default options are used. The prefix is matched literally,
+// and it panics if the prefix contains a parameter.
+func (m *RouteMux) StaticFS(pattern string, fsys fs.FS, opts *StaticOptions) *Route {
+	if opts == nil {
+		opts = &StaticOptions{}
+	}
+	s, err := static.New(pattern, fsys, opts.options(), m.error)
+	if err != nil {
+		panic(err)
+	}
+	return m.Get(s.Pattern(), s.ServeHTTP)
 }
 
 // Adds a new Route to the Handler
-func (m *RouteMux) AddRoute(method string, pattern string, handler http.HandlerFunc) {
+func (m *RouteMux) AddRoute(method string, pattern string, handler http.HandlerFunc) *Route {
 
 	//split the url into sections
 	parts := strings.Split(pattern, "/")
@@ -112,23 +275,24 @@ func (m *RouteMux) AddRoute(method string, pattern string, handler http.HandlerF
 
 	//recreate the url pattern, with parameters replaced
 	//by regular expressions. then compile the regex
-	pattern = strings.Join(parts, "/")
-	regex, regexErr := regexp.Compile(pattern)
+	expr := strings.Join(parts, "/")
+	regex, regexErr := regexp.Compile(expr)
 	if regexErr != nil {
 		//TODO add error handling here to avoid panic
 		panic(regexErr)
-		return
 	}
 
 	//now create the Route
-	route := &route{}
+	route := &Route{}
 	route.method = method
+	route.pattern = pattern
 	route.regex = regex
 	route.handler = handler
 	route.params = params
 
 	//and finally append to the list of Routes
 	m.routes = append(m.routes, route)
+	return route
 }
 
 // Filter adds the middleware filter.
@@ -136,6 +300,40 @@ func (m *RouteMux) Filter(filter http.HandlerFunc) {
 	m.filters = append(m.filters, filter)
 }
 
+// After adds the middleware filter that is executed after the request
+// has been handled, even if the handler panics. Filters are executed in
+// the order they were added.
+func (m *RouteMux) After(filter AfterFunc) {
+	m.after = append(m.after, filter)
+}
+
+// ErrorHandler sets the function used to render the error responses
+// generated by the RouteMux. By default a plain text response is written with
+// the status text of the code.
+func (m *RouteMux) ErrorHandler(handler ErrorFunc) {
+	m.errors = handler
+}
+
+// OnPanic adds a hook that is invoked when a panic is recovered while
+// serving a request.
+func (m *RouteMux) OnPanic(hook PanicFunc) {
+	m.panics = append(m.panics, hook)
+}
+
+// MapError maps the errors returned by handlers that match the target, as
+// reported by errors.Is, to the status code. For example:
+//
+//	m.MapError(sql.ErrNoRows, http.StatusNotFound)
+func (m *RouteMux) MapError(target error, code int) {
+	m.mappings = append(m.mappings, errorMapping{target, code})
+}
+
+// OnError adds a hook that is invoked with the errors returned by the
+// handlers adapted with Handle.
+func (m *RouteMux) OnError(hook HandlerErrorFunc) {
+	m.hooks = append(m.hooks, hook)
+}
+
 // FilterParam adds the middleware filter iff the REST URL parameter exists.
 func (m *RouteMux) FilterParam(param string, filter http.HandlerFunc) {
 	if !strings.HasPrefix(param,":") {
@@ -155,14 +353,31 @@ func (m *RouteMux) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	requestPath := r.URL.Path
 
 	//wrap the response writer, in our custom interface
-	w := &responseWriter{writer: rw}
+	w := &responseWriter{writer: rw, mux: m, start: time.Now()}
+
+	//recover from panics, and execute the after filters once
+	//the request is handled
+	defer func() {
+		if err := recover(); err != nil {
+			if err == http.ErrAbortHandler {
+				m.complete(w, r, http.StatusInternalServerError)
+				panic(err)
+			}
+			m.recover(w, r, err)
+		}
+		m.complete(w, r, http.StatusOK)
+	}()
+
+	//serve HEAD requests with the GET routes, unless a HEAD route
+	//matches the url
+	method := m.method(r)
 
 	//find a matching Route
 	for _, route := range m.routes {
 
 		//if the methods don't match, skip this handler
 		//i.e if request.Method is 'PUT' Route.Method must be 'PUT'
-		if r.Method != route.method {
+		if method != route.method {
 			continue
 		}
 
@@ -191,6 +406,9 @@ func (m *RouteMux) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			//r.URL.RawQuery = url.Values(values).Encode()
 		}
 
+		//record the route pattern matched by the request
+		w.pattern = route.pattern
+
 		//execute middleware filters
 		for _, filter := range m.filters {
 			filter(w, r)
@@ -199,28 +417,237 @@ func (m *RouteMux) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		//execute the route specific middleware filters
+		for _, filter := range route.filters {
+			filter(w, r)
+			if w.started {
+				return
+			}
+		}
+
 		//Invoke the request handler
 		route.handler(w, r)
 		break
 	}
 
+	//if the url only matches routes for other methods, throw a
+	//method not allowed exception
+	if w.started == false && w.pattern == "" {
+		if allow := m.allowed(requestPath); len(allow) != 0 {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			m.error(w, r, http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
 	//if no matches to url, throw a not found exception
 	if w.started == false {
-		http.NotFound(w, r)
+		m.error(w, r, http.StatusNotFound)
+	}
+}
+
+// match reports whether the route pattern matches the whole url path.
+func (r *Route) match(path string) bool {
+	matches := r.regex.FindStringSubmatch(path)
+	return len(matches) != 0 && len(matches[0]) == len(path)
+}
+
+// method returns the method of the routes that serve the request. HEAD
+// requests are served by the GET routes, unless a HEAD route matches the url
+// path.
+func (m *RouteMux) method(r *http.Request) string {
+	if r.Method != HEAD {
+		return r.Method
+	}
+	for _, route := range m.routes {
+		if route.method == HEAD && route.match(r.URL.Path) {
+			return HEAD
+		}
+	}
+	return GET
+}
+
+// allowed returns the methods of the routes that match the url path,
+// including HEAD if GET is allowed.
+func (m *RouteMux) allowed(path string) []string {
+	var methods []string
+	seen := make(map[string]bool)
+	for _, route := range m.routes {
+		if seen[route.method] || !route.match(path) {
+			continue
+		}
+		seen[route.method] = true
+		methods = append(methods, route.method)
+	}
+	if seen[GET] && !seen[HEAD] {
+		methods = append(methods, HEAD)
+	}
+	return methods
+}
+
+// complete executes the after filters. If the response has not been
+// written to, the filters receive the provided default status code.
+func (m *RouteMux) complete(w *responseWriter, r *http.Request, status int) {
+	if w.status != 0 {
+		status = w.status
+	} else if w.started {
+		status = http.StatusOK
+	}
+
+	for _, filter := range m.after {
+		filter(w, r, status)
+	}
+}
+
+// error renders an error response with the given status code, using the
+// ErrorFunc configured for the RouteMux.
+func (m *RouteMux) error(w http.ResponseWriter, r *http.Request, code int) {
+	if m.errors != nil {
+		m.errors(w, r, code)
+		return
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// Handle adapts a handler that returns an error to an http.HandlerFunc. If
+// the handler returns an error, and the response has not been written to,
+// the error is mapped to a status code and rendered with the ErrorFunc of
+// the RouteMux. The status code is given by the first error registered with
+// MapError that matches the error, or by the StatusCode method of the first
+// error in its chain that implements StatusCoder. Other errors are rendered
+// as 500 Internal Server Error.
+func Handle(handler func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := handler(w, r)
+		if err == nil {
+			return
+		}
+		if info, ok := Response(w); ok {
+			rw := info.(*responseWriter)
+			rw.mux.handleError(rw, r, err)
+			return
+		}
+		code := statusOf(nil, err)
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+// handleError reports the error returned by a handler to the hooks, and
+// renders it if the response has not been written to. Server errors are
+// logged.
+func (m *RouteMux) handleError(w *responseWriter, r *http.Request, err error) {
+	for _, hook := range m.hooks {
+		hook(r, err)
+	}
+
+	code := statusOf(m.mappings, err)
+	if code >= 500 {
+		log.Printf("routes: error serving %s %s (route %q): %v", r.Method, r.URL.Path, w.pattern, err)
+	}
+	if !w.started {
+		m.error(w, r, code)
+	}
+}
+
+// statusOf returns the status code of the error, using the mappings, or the
+// StatusCoder interface. It returns 500 if the error is not mapped, or is
+// mapped to an invalid status code.
+func statusOf(mappings []errorMapping, err error) int {
+	for _, mapping := range mappings {
+		if errors.Is(err, mapping.target) {
+			return validStatus(mapping.code)
+		}
+	}
+	var coder StatusCoder
+	if errors.As(err, &coder) {
+		return validStatus(coder.StatusCode())
+	}
+	return http.StatusInternalServerError
+}
+
+// validStatus returns the status code if it is a valid final status, which
+// can be written without net/http panicking, or 500 otherwise.
+func validStatus(code int) int {
+	if code < 200 || code > 999 {
+		return http.StatusInternalServerError
+	}
+	return code
+}
+
+// recover handles a panic recovered while serving the request. The panic is
+// logged with the stack trace and matched route pattern, and reported to
+// the panic hooks. If the response has not been written to, a 500 error is
+// rendered.
+func (m *RouteMux) recover(w *responseWriter, r *http.Request, err interface{}) {
+	p := &Panic{Value: err, Stack: debug.Stack(), Pattern: w.pattern}
+	log.Printf("routes: panic serving %s %s (route %q): %v\n%s", r.Method, r.URL.Path, p.Pattern, p.Value, p.Stack)
+
+	for _, hook := range m.panics {
+		hook(r, p)
+	}
+
+	if !w.started {
+		m.error(w, r, http.StatusInternalServerError)
 	}
 }
 
 // -----------------------------------------------------------------------------
 // Simple wrapper around a ResponseWriter
 
+// ResponseInfo is a read-only view of the response recorded by the RouteMux.
+// It allows middleware, such as logging, metrics or tracing, to inspect the
+// response without wrapping the http.ResponseWriter again.
+type ResponseInfo interface {
+	// Status returns the status code written to the response, or 0 if
+	// nothing has been written yet. A response written without calling
+	// WriteHeader reports 200 OK.
+	Status() int
+
+	// BytesWritten returns the number of bytes written to the response body.
+	BytesWritten() int64
+
+	// Start returns the time the RouteMux started handling the request.
+	Start() time.Time
+
+	// TimeToFirstByte returns the time elapsed between the start of the
+	// request and the first write to the response, or 0 if nothing has
+	// been written yet.
+	TimeToFirstByte() time.Duration
+
+	// Pattern returns the route pattern matched by the request, or an empty
+	// string if no route was matched.
+	Pattern() string
+}
+
+// Response returns the ResponseInfo recorded by the RouteMux for the given
+// http.ResponseWriter. Writers that wrap the RouteMux's writer are unwrapped
+// using their Unwrap method.
+func Response(w http.ResponseWriter) (ResponseInfo, bool) {
+	for {
+		switch v := w.(type) {
+		case *responseWriter:
+			return v, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
 // responseWriter is a wrapper for the http.ResponseWriter
 // to track if response was written to. It also allows us
 // to automatically set certain headers, such as Content-Type,
 // Access-Control-Allow-Origin, etc.
 type responseWriter struct {
 	writer  http.ResponseWriter
+	mux     *RouteMux
 	started bool
 	status  int
+	pattern string
+	written int64     // number of bytes written to the body
+	start   time.Time // time the request was started
+	first   time.Time // time of the first write to the response
 }
 
 // Header returns the header map that will be sent by WriteHeader.
@@ -231,18 +658,125 @@ func (w *responseWriter) Header() http.Header {
 // Write writes the data to the connection as part of an HTTP reply,
 // and sets `started` to true
 func (w *responseWriter) Write(p []byte) (int, error) {
-	w.started = true
-	return w.writer.Write(p)
+	w.begin(http.StatusOK)
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
 }
 
 // WriteHeader sends an HTTP response header with status code,
 // and sets `started` to true
 func (w *responseWriter) WriteHeader(code int) {
-	w.status = code
-	w.started = true
+	w.begin(code)
 	w.writer.WriteHeader(code)
 }
 
+// begin records the status code and time of the first write to the
+// response, and sets `started` to true
+func (w *responseWriter) begin(code int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.status = code
+	w.first = time.Now()
+}
+
+// Status returns the status code written to the response.
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the number of bytes written to the response body.
+func (w *responseWriter) BytesWritten() int64 {
+	return w.written
+}
+
+// Start returns the time the request was started.
+func (w *responseWriter) Start() time.Time {
+	return w.start
+}
+
+// TimeToFirstByte returns the time elapsed between the start of the request
+// and the first write to the response.
+func (w *responseWriter) TimeToFirstByte() time.Duration {
+	if w.first.IsZero() {
+		return 0
+	}
+	return w.first.Sub(w.start)
+}
+
+// Pattern returns the route pattern matched by the request.
+func (w *responseWriter) Pattern() string {
+	return w.pattern
+}
+
+// Flush sends any buffered data to the client, if supported by the
+// underlying http.ResponseWriter.
+func (w *responseWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError sends any buffered data to the client, and returns an error
+// if the underlying http.ResponseWriter does not support flushing.
+func (w *responseWriter) FlushError() error {
+	switch f := w.writer.(type) {
+	case interface{ FlushError() error }:
+		w.begin(http.StatusOK)
+		return f.FlushError()
+	case http.Flusher:
+		w.begin(http.StatusOK)
+		f.Flush()
+		return nil
+	}
+	return http.ErrNotSupported
+}
+
+// Push initiates an HTTP/2 server push, if supported by the underlying
+// http.ResponseWriter.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.writer.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// ReadFrom reads data from src until EOF and writes it to the connection,
+// using the underlying io.ReaderFrom if available to enable zero-copy sends.
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.begin(http.StatusOK)
+	var n int64
+	var err error
+	if rf, ok := w.writer.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(w.writer, src)
+	}
+	w.written += n
+	return n, err
+}
+
+// The Hijacker interface is implemented by ResponseWriters that allow an
+// HTTP handler to take over the connection. An error is returned if the
+// underlying http.ResponseWriter does not support hijacking.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.started = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter, which allows the
+// http.ResponseController to access its optional interfaces.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.writer
+}
+
 // -----------------------------------------------------------------------------
 // Below are helper functions to replace boilerplate
 // code that serializes resources and writes to the
@@ -276,13 +810,20 @@ func ReadJson(r *http.Request, v interface{}) error {
 // ServeXml replies to the request with an XML
 // representation of resource v.
 func ServeXml(w http.ResponseWriter, v interface{}) {
+	serveXml(w, v, "text/xml; charset=utf-8")
+}
+
+// serveXml replies to the request with an XML
+// representation of resource v, with the specified
+// Content-Type.
+func serveXml(w http.ResponseWriter, v interface{}, contentType string) {
 	content, err := xml.Marshal(v)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
-	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.Header().Set("Content-Type", contentType)
 	w.Write(content)
 }
 
@@ -298,20 +839,47 @@ func ReadXml(r *http.Request, v interface{}) error {
 	return xml.Unmarshal(body, v)
 }
 
+// Media types supported by ServeFormatted, in order of preference.
+var formats = []string{applicationJson, applicationXml, textXml}
+
 // ServeFormatted replies to the request with
 // a formatted representation of resource v, in the
 // format requested by the client specified in the
-// Accept header.
+// Accept header, either JSON or XML. JSON is served if
+// the client accepts both equally. If the client accepts
+// neither, a 406 Not Acceptable error is written with
+// the list of supported types.
 func ServeFormatted(w http.ResponseWriter, r *http.Request, v interface{}) {
-	accept := r.Header.Get("Accept")
-	switch accept {
+	w.Header().Add("Vary", "Accept")
+
+	switch Negotiate(r, formats...) {
 	case applicationJson:
 		ServeJson(w, v)
-	case applicationXml, textXml:
-		ServeXml(w, v)
+	case applicationXml:
+		serveXml(w, v, "application/xml; charset=utf-8")
+	case textXml:
+		serveXml(w, v, "text/xml; charset=utf-8")
 	default:
-		ServeJson(w, v)
+		NotAcceptable(w, formats...)
 	}
+}
+
+// NotAcceptable writes a 406 Not Acceptable error, with the list of media
+// types supported by the handler.
+func NotAcceptable(w http.ResponseWriter, offers ...string) {
+	msg := http.StatusText(http.StatusNotAcceptable) + ". Supported types: " + strings.Join(offers, ", ")
+	http.Error(w, msg, http.StatusNotAcceptable)
+}
 
-	return
+// Negotiate returns the media type from the list of offers that best
+// matches the Accept header of the request, as defined by RFC 9110. The
+// offer with the highest quality value is returned, and ties are resolved
+// in the order of the offers. Each offer is weighted by the most specific
+// media range that matches it, so that "text/*;q=0.5, text/html" prefers
+// text/html over text/plain.
+//
+// If the request has no Accept header, or it is empty, the first offer is returned. If none
+// of the offers is acceptable an empty string is returned.
+func Negotiate(r *http.Request, offers ...string) string {
+	return header.Negotiate(r.Header.Values("Accept"), offers...)
 }